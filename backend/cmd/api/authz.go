@@ -0,0 +1,198 @@
+// Filename: MyReference/backend/cmd/api/authz.go
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"mgomez.net/internal/authz"
+	"mgomez.net/internal/data"
+	"mgomez.net/internal/validator"
+)
+
+// newPolicy() returns the rules every request and every loaded record is checked against
+func newPolicy() *authz.Policy {
+	return authz.New(
+		authz.Rule{
+			Name:        "activated-users-only",
+			Description: "the account must be activated",
+			Effect:      authz.Deny,
+			Actions:     []string{"*"},
+			When:        authz.Not(authz.Activated()),
+		},
+		authz.Rule{
+			Name:         "archived-references",
+			Description:  "references stored in the archive can only be changed by workspace owners",
+			Effect:       authz.Deny,
+			Actions:      []string{"reference:write", "reference:delete"},
+			ResourceType: "reference",
+			When:         authz.All(authz.FieldHasPrefix("location", "archive/"), authz.Not(authz.WorkspaceRole(data.WorkspaceOwner))),
+		},
+		authz.Rule{
+			Name:         "reference-creator-or-owner-deletes",
+			Description:  "references can be deleted by the user who created them or a workspace owner",
+			Effect:       authz.Allow,
+			Actions:      []string{"reference:delete"},
+			ResourceType: "reference",
+			When:         authz.All(authz.HasPermission("reference:write"), authz.Any(authz.IsOwner(), authz.WorkspaceRole(data.WorkspaceOwner))),
+		},
+		authz.Rule{
+			Name:        "granted-permission",
+			Description: "the user holds the permission named by the action",
+			Effect:      authz.Allow,
+			Actions:     []string{"*"},
+			When:        authz.ActionIsPermission(),
+		},
+	)
+}
+
+// authorize() evaluates the policy for the request, and for the record when one is supplied.
+// If the action is denied the response is written and false returned
+func (app *application) authorize(w http.ResponseWriter, r *http.Request, action string, resource *authz.Resource) bool {
+	subject, err := app.requestSubject(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	decision := app.policy.Evaluate(authz.Input{Subject: subject, Action: action, Resource: resource})
+	if !decision.Allowed {
+		app.notPermittedResponse(w, r)
+		return false
+	}
+	return true
+}
+
+// requestSubject() describes the user making the request. API keys and third-party applications
+// only carry the permissions they were restricted to
+func (app *application) requestSubject(r *http.Request) (authz.Subject, error) {
+	subject, err := app.userSubject(app.contextGetUser(r), app.contextGetWorkspace(r))
+	if err != nil {
+		return subject, err
+	}
+
+	var restrictedTo data.Permissions
+	switch {
+	case app.contextGetAPIKey(r) != nil:
+		restrictedTo = app.contextGetAPIKey(r).Permissions
+	case app.contextGetOAuthToken(r) != nil:
+		restrictedTo = app.contextGetOAuthToken(r).Scopes
+	default:
+		return subject, nil
+	}
+	permissions := []string{}
+	for _, code := range subject.Permissions {
+		if restrictedTo.Include(code) {
+			permissions = append(permissions, code)
+		}
+	}
+	subject.Permissions = permissions
+	return subject, nil
+}
+
+// userSubject() describes a user, with their role in the workspace when one is given
+func (app *application) userSubject(user *data.User, workspaceID int64) (authz.Subject, error) {
+	if user.IsAnonymous() {
+		return authz.Subject{Anonymous: true, Permissions: []string{}}, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return authz.Subject{}, err
+	}
+	subject := authz.Subject{
+		UserID:      user.ID,
+		Activated:   user.Activated,
+		Permissions: permissions,
+	}
+
+	if workspaceID != 0 {
+		role, err := app.models.Workspaces.GetRole(workspaceID, user.ID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			return authz.Subject{}, err
+		}
+		subject.WorkspaceID = workspaceID
+		subject.WorkspaceRole = role
+	}
+	return subject, nil
+}
+
+// referenceResource() exposes a reference's fields to the policy
+func referenceResource(reference *data.Reference) *authz.Resource {
+	return &authz.Resource{
+		Type:        "reference",
+		ID:          reference.ID,
+		OwnerID:     reference.UserID,
+		WorkspaceID: reference.WorkspaceID,
+		Fields: map[string]interface{}{
+			"name":     reference.Name,
+			"location": reference.Location,
+			"version":  reference.Version,
+		},
+	}
+}
+
+// authzCheckHandler() shows administrators how the policy decides an action for a user, and why
+func (app *application) authzCheckHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID      int64  `json:"user_id"`
+		Action      string `json:"action"`
+		WorkspaceID int64  `json:"workspace_id"`
+		ReferenceID int64  `json:"reference_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.UserID > 0, "user_id", "must be provided")
+	v.Check(input.Action != "", "action", "must be provided")
+	v.Check(input.ReferenceID == 0 || input.WorkspaceID > 0, "workspace_id", "must be provided together with a reference")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.WithContext(r.Context()).Users.Get(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("user_id", "no matching user found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	subject, err := app.userSubject(user, input.WorkspaceID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var resource *authz.Resource
+	if input.ReferenceID != 0 {
+		reference, err := app.models.WithContext(r.Context()).Reference.Get(input.ReferenceID, input.WorkspaceID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("reference_id", "no matching reference found in the workspace")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		resource = referenceResource(reference)
+	}
+
+	decision := app.policy.Evaluate(authz.Input{Subject: subject, Action: input.Action, Resource: resource})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"decision": decision, "subject": subject, "resource": resource}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,67 @@
+// Filename: MyReference/backend/cmd/api/authz_test.go
+package main
+
+import (
+	"testing"
+
+	"mgomez.net/internal/authz"
+	"mgomez.net/internal/data"
+)
+
+func TestPolicy(t *testing.T) {
+	policy := newPolicy()
+
+	writer := authz.Subject{
+		UserID:        1,
+		Activated:     true,
+		Permissions:   []string{"reference:read", "reference:write"},
+		WorkspaceID:   10,
+		WorkspaceRole: data.WorkspaceEditor,
+	}
+	owner := writer
+	owner.UserID = 2
+	owner.WorkspaceRole = data.WorkspaceOwner
+	inactive := writer
+	inactive.Activated = false
+	reader := writer
+	reader.Permissions = []string{"reference:read"}
+
+	reference := func(ownerID int64, location string) *authz.Resource {
+		return referenceResource(&data.Reference{ID: 5, UserID: ownerID, WorkspaceID: 10, Location: location})
+	}
+
+	tests := []struct {
+		name     string
+		subject  authz.Subject
+		action   string
+		resource *authz.Resource
+		allowed  bool
+		rule     string
+	}{
+		{"granted permission", writer, "reference:write", nil, true, "granted-permission"},
+		{"missing permission", reader, "reference:write", nil, false, ""},
+		{"inactive user", inactive, "reference:read", nil, false, "activated-users-only"},
+		{"anonymous user", authz.Subject{Anonymous: true}, "reference:read", nil, false, "activated-users-only"},
+		{"creator deletes", writer, "reference:delete", reference(1, "shelf/1"), true, "reference-creator-or-owner-deletes"},
+		{"owner deletes another user's reference", owner, "reference:delete", reference(1, "shelf/1"), true, "reference-creator-or-owner-deletes"},
+		{"editor can't delete another user's reference", writer, "reference:delete", reference(3, "shelf/1"), false, ""},
+		{"editor can't delete a reference without a creator", writer, "reference:delete", reference(0, "shelf/1"), false, ""},
+		{"creator needs the write permission", reader, "reference:delete", reference(1, "shelf/1"), false, ""},
+		{"archived reference can't be changed by an editor", writer, "reference:write", reference(1, "archive/1"), false, "archived-references"},
+		{"archived reference can't be deleted by its creator", writer, "reference:delete", reference(1, "archive/1"), false, "archived-references"},
+		{"archived reference can be changed by an owner", owner, "reference:write", reference(1, "archive/1"), true, "granted-permission"},
+		{"archived reference can be read", reader, "reference:read", reference(1, "archive/1"), true, "granted-permission"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := policy.Evaluate(authz.Input{Subject: tt.subject, Action: tt.action, Resource: tt.resource})
+			if decision.Allowed != tt.allowed {
+				t.Errorf("got allowed %t; want %t (%s)", decision.Allowed, tt.allowed, decision.Reason)
+			}
+			if decision.Rule != tt.rule {
+				t.Errorf("got rule %q; want %q", decision.Rule, tt.rule)
+			}
+		})
+	}
+}
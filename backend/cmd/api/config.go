@@ -0,0 +1,541 @@
+// Filename: MyReference/backend/cmd/api/config.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"mgomez.net/internal/jsonlog.go"
+	"mgomez.net/internal/validator"
+)
+
+// configuration settings
+type config struct {
+	file          string
+	printConfig   bool
+	port          int
+	shutdownDelay time.Duration
+	env           string
+	logLevel      string
+	defaultRole   string
+	invitationTTL time.Duration
+	db            struct {
+		dsn          string
+		maxOpenConns int
+		maxIdleConns int
+		maxIdleTime  string
+		autoMigrate  bool
+	}
+	limiter struct {
+		rps        float64
+		burst      int
+		loginRPS   float64
+		loginBurst int
+		ipRPS      float64
+		ipBurst    int
+		enabled    bool
+		backend    string
+		failOpen   bool
+		redis      struct {
+			addr     string
+			password string
+			timeout  time.Duration
+		}
+	}
+	trustedProxies []*net.IPNet
+	smtp           struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	cors struct {
+		trustedOrigins   []string
+		allowCredentials bool
+		maxAge           time.Duration
+	}
+	cache struct {
+		size int
+		ttl  time.Duration
+	}
+	password struct {
+		hasher      string
+		bcryptCost  int
+		memory      uint
+		iterations  uint
+		parallelism uint
+		minEntropy  float64
+		personal    bool
+		breached    string
+	}
+	lockout struct {
+		threshold   int
+		ipThreshold int
+		window      time.Duration
+		duration    time.Duration
+		maxDuration time.Duration
+	}
+	tracing struct {
+		exporter string
+		endpoint string
+		ratio    float64
+	}
+	oidc struct {
+		issuer       string
+		clientID     string
+		clientSecret string
+		redirectURL  string
+	}
+}
+
+// defineFlags() declares every setting as a flag. The flag names are also the keys of the config
+// file and, upper cased with an MREF_ prefix, the names of the environment variables
+func defineFlags(fs *flag.FlagSet, cfg *config) {
+	fs.StringVar(&cfg.file, "config", "", "YAML or TOML config file (or MREF_CONFIG)")
+	fs.BoolVar(&cfg.printConfig, "print-config", false, "Print the settings and where each came from, then exit")
+
+	fs.IntVar(&cfg.port, "port", 4000, "API server port")
+	fs.DurationVar(&cfg.shutdownDelay, "shutdown-delay", 0, "How long to keep serving, reporting not ready, before shutting down")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development | staging | production)")
+	fs.StringVar(&cfg.logLevel, "log-level", "info", "Minimum level of log entries written (info | error | fatal | off)")
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	fs.BoolVar(&cfg.db.autoMigrate, "db-auto-migrate", false, "Apply pending migrations on startup")
+
+	fs.StringVar(&cfg.defaultRole, "default-role", "user", "Role given to newly registered users (empty for none)")
+	fs.DurationVar(&cfg.invitationTTL, "invitation-ttl", 7*24*time.Hour, "How long an emailed invitation can be accepted")
+
+	//flags for the rate limiter
+	fs.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum request per second")
+	fs.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	fs.Float64Var(&cfg.limiter.loginRPS, "limiter-login-rps", 0.2, "Rate limiter maximum login attempts per second")
+	fs.IntVar(&cfg.limiter.loginBurst, "limiter-login-burst", 5, "Rate limiter maximum login burst")
+	fs.Float64Var(&cfg.limiter.ipRPS, "limiter-ip-rps", 20, "Rate limiter maximum requests per second from one IP address, checked before authentication")
+	fs.IntVar(&cfg.limiter.ipBurst, "limiter-ip-burst", 40, "Rate limiter maximum burst from one IP address")
+	fs.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Rate limiter enabledS")
+	fs.StringVar(&cfg.limiter.backend, "limiter-backend", "memory", "Rate limiter backend (memory | redis), use redis to share budgets between replicas")
+	fs.BoolVar(&cfg.limiter.failOpen, "limiter-fail-open", true, "Let requests through when the rate limiter backend is unavailable")
+	fs.StringVar(&cfg.limiter.redis.addr, "limiter-redis-addr", "localhost:6379", "Redis address for the redis rate limiter backend")
+	fs.StringVar(&cfg.limiter.redis.password, "limiter-redis-password", "", "Redis password")
+	fs.DurationVar(&cfg.limiter.redis.timeout, "limiter-redis-timeout", 100*time.Millisecond, "Redis connection and command timeout")
+
+	//Only proxies we run are allowed to tell us the client address with X-Forwarded-For
+	fs.Func("trusted-proxies", "Trusted proxy IP addresses or CIDR ranges (space separated)", func(val string) error {
+		var networks []*net.IPNet
+		for _, field := range strings.Fields(val) {
+			if !strings.Contains(field, "/") {
+				if strings.Contains(field, ":") {
+					field += "/128"
+				} else {
+					field += "/32"
+				}
+			}
+			_, network, err := net.ParseCIDR(field)
+			if err != nil {
+				return err
+			}
+			networks = append(networks, network)
+		}
+		cfg.trustedProxies = networks
+		return nil
+	})
+
+	//flags for the cache of authentication tokens and permissions
+	fs.IntVar(&cfg.cache.size, "cache-size", 10000, "Maximum number of cached tokens and permission sets (0 disables the cache)")
+	fs.DurationVar(&cfg.cache.ttl, "cache-ttl", time.Minute, "Longest time a cached entry is used")
+
+	//flags for password hashing
+	fs.StringVar(&cfg.password.hasher, "password-hasher", "argon2id", "Password hashing algorithm (argon2id | bcrypt)")
+	fs.IntVar(&cfg.password.bcryptCost, "password-bcrypt-cost", 12, "bcrypt cost")
+	fs.UintVar(&cfg.password.memory, "password-argon2-memory", 64*1024, "argon2id memory in KiB")
+	fs.UintVar(&cfg.password.iterations, "password-argon2-iterations", 3, "argon2id number of iterations")
+	fs.UintVar(&cfg.password.parallelism, "password-argon2-parallelism", 2, "argon2id degree of parallelism")
+
+	//flags for the password policy
+	fs.Float64Var(&cfg.password.minEntropy, "password-min-entropy", 36, "Minimum estimated password strength in bits (0 disables the check)")
+	fs.BoolVar(&cfg.password.personal, "password-reject-personal", true, "Reject passwords containing the user's name or email")
+	fs.StringVar(&cfg.password.breached, "password-breached-file", "", "File of SHA-1 hashes of breached passwords")
+
+	//flags for the login lockout
+	fs.IntVar(&cfg.lockout.threshold, "lockout-threshold", 5, "Failed logins before an account is locked")
+	fs.IntVar(&cfg.lockout.ipThreshold, "lockout-ip-threshold", 20, "Failed logins before an IP address is locked")
+	fs.DurationVar(&cfg.lockout.window, "lockout-window", 15*time.Minute, "Period after which failed logins are forgotten")
+	fs.DurationVar(&cfg.lockout.duration, "lockout-duration", time.Minute, "Initial lockout duration, doubled for each further failure")
+	fs.DurationVar(&cfg.lockout.maxDuration, "lockout-max-duration", time.Hour, "Maximum lockout duration")
+
+	//These are flags for the mailer
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "smtp.mailtrap.io", "SMTP host")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "MyReference <no-reply@MyReference.sophia.net>", "SMPT sender")
+
+	//flags for single sign-on with an OpenID Connect provider
+	fs.StringVar(&cfg.oidc.issuer, "oidc-issuer", "", "OpenID Connect issuer URL (empty disables SSO)")
+	fs.StringVar(&cfg.oidc.clientID, "oidc-client-id", "", "OpenID Connect client id")
+	fs.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", "", "OpenID Connect client secret")
+	fs.StringVar(&cfg.oidc.redirectURL, "oidc-redirect-url", "http://localhost:4000/v1/oidc/callback", "OpenID Connect redirect URL registered with the provider")
+
+	//Use the fs.func() function to parse our trusted origins flag form a string to a []string
+	fs.Func("cors-trusted-origins", "Trusted CORS origins, space separated, https://*.example.com matches any subdomain", func(val string) error {
+		origins := strings.Fields(val)
+		for _, origin := range origins {
+			if !validOriginPattern(origin) {
+				return fmt.Errorf("invalid origin %q", origin)
+			}
+		}
+		cfg.cors.trustedOrigins = origins
+		return nil
+	})
+	fs.BoolVar(&cfg.cors.allowCredentials, "cors-allow-credentials", true, "Allow trusted origins to send credentials")
+	fs.DurationVar(&cfg.cors.maxAge, "cors-max-age", 10*time.Minute, "How long browsers may cache a preflight response")
+
+	//flags for request tracing
+	fs.StringVar(&cfg.tracing.exporter, "tracing-exporter", "none", "Where traces are sent (none | stdout | otlp)")
+	fs.StringVar(&cfg.tracing.endpoint, "tracing-otlp-endpoint", "http://localhost:4318", "OpenTelemetry collector OTLP/HTTP endpoint")
+	fs.Float64Var(&cfg.tracing.ratio, "tracing-sample-ratio", 1, "Share of new traces that are recorded, between 0 and 1")
+
+}
+
+// envAliases are environment variables read before every setting could be set from the environment
+var envAliases = map[string]string{
+	"limiter-redis-password": "MREF_REDIS_PASSWORD",
+}
+
+// secretSettings are redacted whenever settings are printed or logged
+var secretSettings = map[string]bool{
+	"smtp-password":          true,
+	"limiter-redis-password": true,
+	"oidc-client-secret":     true,
+}
+
+// setting is one configuration value and the layer it came from. value has secrets redacted,
+// text is what was actually set and is only used to spot changes
+type setting struct {
+	name   string
+	value  string
+	text   string
+	source string
+}
+
+// recordedValue remembers the text a flag was last set to, the flags made with fs.Func can't print their value
+type recordedValue struct {
+	flag.Value
+	text *string
+}
+
+func (v recordedValue) Set(s string) error {
+	err := v.Value.Set(s)
+	if err == nil {
+		*v.text = s
+	}
+	return err
+}
+
+// recordedBoolValue keeps boolean flags usable without a value
+type recordedBoolValue struct {
+	recordedValue
+}
+
+func (recordedBoolValue) IsBoolFlag() bool { return true }
+
+// loadConfig() builds the configuration from the defaults, then the config file, then MREF_*
+// environment variables, then the command line, each layer overriding the one before. It returns
+// the settings for printing and the arguments left after the flags
+func loadConfig(args []string) (config, []setting, []string, error) {
+	var cfg config
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	defineFlags(fs, &cfg)
+
+	//the help is printed from unwrapped flags so it still shows each flag's type
+	fs.Usage = func() {
+		plain := flag.NewFlagSet("api", flag.ContinueOnError)
+		defineFlags(plain, &config{})
+		plain.SetOutput(fs.Output())
+		fmt.Fprintf(fs.Output(), "Usage: api [flags] [migrate up | down | status | goto VERSION | force VERSION]\n\nSettings can also be given in the -config file or as MREF_* environment variables.\n\n")
+		plain.PrintDefaults()
+	}
+
+	texts := make(map[string]*string)
+	fs.VisitAll(func(f *flag.Flag) {
+		text := f.DefValue
+		texts[f.Name] = &text
+		recorded := recordedValue{Value: f.Value, text: &text}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			f.Value = recordedBoolValue{recorded}
+		} else {
+			f.Value = recorded
+		}
+	})
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, nil, nil, err
+	}
+	sources := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = "flag"
+	})
+
+	if cfg.file == "" {
+		cfg.file = os.Getenv("MREF_CONFIG")
+	}
+	var fileValues map[string]string
+	if cfg.file != "" {
+		fileValues, err = readConfigFile(cfg.file)
+		if err != nil {
+			return cfg, nil, nil, err
+		}
+		for name := range fileValues {
+			if fs.Lookup(name) == nil || name == "config" || name == "print-config" {
+				return cfg, nil, nil, fmt.Errorf("config file %s: unknown setting %q", cfg.file, name)
+			}
+		}
+	}
+
+	//fill in what the command line left unset, environment variables winning over the file
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] != "" || f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		if value, ok := lookupEnv(f.Name); ok {
+			sources[f.Name] = "env"
+			err = fs.Set(f.Name, value)
+		} else if value, ok := fileValues[f.Name]; ok {
+			sources[f.Name] = "file"
+			err = fs.Set(f.Name, value)
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid value for %s from %s: %w", f.Name, sources[f.Name], err)
+		}
+	})
+	if err != nil {
+		return cfg, nil, nil, err
+	}
+
+	var settings []setting
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		source := sources[f.Name]
+		if source == "" {
+			source = "default"
+		}
+		settings = append(settings, setting{name: f.Name, value: redact(f.Name, *texts[f.Name]), text: *texts[f.Name], source: source})
+	})
+
+	err = cfg.validate()
+	return cfg, settings, fs.Args(), err
+}
+
+// envName() is the environment variable for a setting, db-max-open-conns is read from MREF_DB_MAX_OPEN_CONNS
+func envName(name string) string {
+	return "MREF_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func lookupEnv(name string) (string, bool) {
+	if value, ok := os.LookupEnv(envName(name)); ok {
+		return value, true
+	}
+	if alias, found := envAliases[name]; found {
+		return os.LookupEnv(alias)
+	}
+	return "", false
+}
+
+// readConfigFile() reads a YAML or TOML file, picked by its extension, into flag names and values.
+// Nested keys are joined with dashes, so db: {max_open_conns: 25} sets db-max-open-conns, and lists
+// become space separated
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(f).Decode(&tree)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".toml":
+		_, err = toml.NewDecoder(f).Decode(&tree)
+	default:
+		return nil, fmt.Errorf("config file %s: must be a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	err = flattenConfig(values, "", tree)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flattenConfig(values map[string]string, prefix string, tree map[string]interface{}) error {
+	for key, value := range tree {
+		name := strings.ReplaceAll(strings.ToLower(key), "_", "-")
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		if _, found := values[name]; found {
+			return fmt.Errorf("%s is set more than once", name)
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			err := flattenConfig(values, name, v)
+			if err != nil {
+				return err
+			}
+			continue
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, " ")
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// redact() hides secrets, the password in the database DSN included
+func redact(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if secretSettings[name] {
+		return "xxxxx"
+	}
+	if name == "db-dsn" {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+		return dsnPassword.ReplaceAllString(value, "${1}xxxxx")
+	}
+	return value
+}
+
+// printConfig() writes the settings in effect and the layer each one came from
+func printConfig(out io.Writer, cfg config, settings []setting) error {
+	if cfg.file != "" {
+		fmt.Fprintf(out, "config file: %s\n\n", cfg.file)
+	}
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, s := range settings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.name, s.value, s.source)
+	}
+	return tw.Flush()
+}
+
+// changedSettings() returns the settings not left at their defaults, for logging at startup
+func changedSettings(settings []setting) map[string]string {
+	changed := make(map[string]string)
+	for _, s := range settings {
+		if s.source != "default" {
+			changed[s.name] = s.value
+		}
+	}
+	return changed
+}
+
+// validate() checks the settings make sense together, reporting every problem at once
+func (cfg config) validate() error {
+	v := validator.New()
+
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be between 1 and 65535")
+	v.Check(validator.In(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+	_, err := jsonlog.ParseLevel(cfg.logLevel)
+	v.Check(err == nil, "log-level", "must be info, error, fatal or off")
+	v.Check(cfg.shutdownDelay >= 0, "shutdown-delay", "must not be negative")
+	v.Check(cfg.invitationTTL > 0, "invitation-ttl", "must be greater than zero")
+
+	v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+	v.Check(cfg.db.maxOpenConns > 0, "db-max-open-conns", "must be greater than zero")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+	_, err = time.ParseDuration(cfg.db.maxIdleTime)
+	v.Check(err == nil, "db-max-idle-time", "must be a duration such as 15m")
+
+	if cfg.limiter.enabled {
+		v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+		v.Check(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+		v.Check(cfg.limiter.loginRPS > 0, "limiter-login-rps", "must be greater than zero")
+		v.Check(cfg.limiter.loginBurst > 0, "limiter-login-burst", "must be greater than zero")
+		v.Check(cfg.limiter.ipRPS > 0, "limiter-ip-rps", "must be greater than zero")
+		v.Check(cfg.limiter.ipBurst > 0, "limiter-ip-burst", "must be greater than zero")
+	}
+	v.Check(validator.In(cfg.limiter.backend, "memory", "redis"), "limiter-backend", "must be memory or redis")
+	if cfg.limiter.backend == "redis" {
+		v.Check(cfg.limiter.redis.addr != "", "limiter-redis-addr", "must be provided for the redis backend")
+		v.Check(cfg.limiter.redis.timeout > 0, "limiter-redis-timeout", "must be greater than zero")
+	}
+
+	v.Check(cfg.smtp.host != "", "smtp-host", "must be provided")
+	v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be between 1 and 65535")
+	v.Check(cfg.smtp.sender != "", "smtp-sender", "must be provided")
+	v.Check(cfg.smtp.username != "" || cfg.smtp.password == "", "smtp-username", "must be provided with smtp-password")
+	v.Check(cfg.smtp.password != "" || cfg.smtp.username == "", "smtp-password", "must be provided with smtp-username")
+
+	v.Check(cfg.cors.maxAge >= 0, "cors-max-age", "must not be negative")
+	v.Check(cfg.cache.size >= 0, "cache-size", "must not be negative")
+	v.Check(cfg.cache.size == 0 || cfg.cache.ttl > 0, "cache-ttl", "must be greater than zero")
+
+	v.Check(validator.In(cfg.password.hasher, "argon2id", "bcrypt"), "password-hasher", "must be argon2id or bcrypt")
+	v.Check(cfg.password.minEntropy >= 0, "password-min-entropy", "must not be negative")
+
+	v.Check(cfg.lockout.threshold > 0, "lockout-threshold", "must be greater than zero")
+	v.Check(cfg.lockout.ipThreshold > 0, "lockout-ip-threshold", "must be greater than zero")
+	v.Check(cfg.lockout.window > 0, "lockout-window", "must be greater than zero")
+	v.Check(cfg.lockout.duration > 0, "lockout-duration", "must be greater than zero")
+	v.Check(cfg.lockout.maxDuration >= cfg.lockout.duration, "lockout-max-duration", "must not be less than lockout-duration")
+
+	v.Check(validator.In(cfg.tracing.exporter, "none", "stdout", "otlp"), "tracing-exporter", "must be none, stdout or otlp")
+	v.Check(cfg.tracing.ratio >= 0 && cfg.tracing.ratio <= 1, "tracing-sample-ratio", "must be between 0 and 1")
+	if cfg.tracing.exporter == "otlp" {
+		v.Check(validator.ValidWebsite(cfg.tracing.endpoint), "tracing-otlp-endpoint", "must be a valid URL")
+	}
+
+	if cfg.oidc.issuer != "" {
+		v.Check(cfg.oidc.clientID != "", "oidc-client-id", "must be provided with oidc-issuer")
+		v.Check(validator.ValidWebsite(cfg.oidc.redirectURL), "oidc-redirect-url", "must be a valid URL")
+	}
+
+	if v.Valid() {
+		return nil
+	}
+	problems := make([]string, 0, len(v.Errors))
+	for name, message := range v.Errors {
+		problems = append(problems, name+" "+message)
+	}
+	sort.Strings(problems)
+	return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+}
@@ -0,0 +1,87 @@
+// Filename: MyReference/backend/cmd/api/config_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	want := map[string]string{
+		"port":                 "4000",
+		"db-max-open-conns":    "25",
+		"db-max-idle-time":     "15m",
+		"limiter-enabled":      "true",
+		"cors-trusted-origins": "http://localhost:9000 http://localhost:9001",
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+		wantErr  bool
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			contents: `
+port: 4000
+db:
+  max_open_conns: 25
+  max_idle_time: 15m
+limiter:
+  enabled: true
+cors:
+  trusted_origins:
+    - http://localhost:9000
+    - http://localhost:9001
+`,
+		},
+		{
+			name: "toml",
+			file: "config.TOML",
+			contents: `
+port = 4000
+
+[db]
+max_open_conns = 25
+max_idle_time = "15m"
+
+[limiter]
+enabled = true
+
+[cors]
+trusted_origins = ["http://localhost:9000", "http://localhost:9001"]
+`,
+		},
+		{name: "unknown extension", file: "config.json", contents: `{"port": 4000}`, wantErr: true},
+		{name: "invalid toml", file: "config.toml", contents: "port = ", wantErr: true},
+		{name: "setting given twice", file: "config.yaml", contents: "db-dsn: a\ndb:\n  dsn: b\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			err := os.WriteFile(path, []byte(tt.contents), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values, err := readConfigFile(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got values %v; want an error", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, want) {
+				t.Errorf("got %v; want %v", values, want)
+			}
+		})
+	}
+}
@@ -15,9 +15,36 @@ type contextKey string
 
 const userContextkey = contextKey("user")
 
+// make the api key a key
+const apiKeyContextKey = contextKey("apiKey")
+
+// make the impersonation a key
+const impersonationContextKey = contextKey("impersonation")
+
+// make the oauth access token a key
+const oauthTokenContextKey = contextKey("oauthToken")
+
+// make the workspace a key
+const workspaceContextKey = contextKey("workspace")
+
+// make the request id a key
+const requestIDContextKey = contextKey("requestID")
+
+// make the request info a key
+const requestInfoContextKey = contextKey("requestInfo")
+
+// requestInfo is filled in by the inner handlers so the outer middleware can log and count the request
+type requestInfo struct {
+	route  string
+	userID int64
+}
+
 //Method to add user to the context
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if info := app.contextGetRequestInfo(r); info != nil {
+		info.userID = user.ID
+	}
 	ctx := context.WithValue(r.Context(), userContextkey, user)
 	return r.WithContext(ctx)
 }
@@ -30,3 +57,88 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// Method to add the API key used to authenticate to the context
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// Retrieve the APIKey struct, nil when the request was not made with a key
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, ok := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	if !ok {
+		return nil
+	}
+	return key
+}
+
+// Method to add the impersonation an administrator is acting under to the context
+func (app *application) contextSetImpersonation(r *http.Request, impersonation *data.Impersonation) *http.Request {
+	ctx := context.WithValue(r.Context(), impersonationContextKey, impersonation)
+	return r.WithContext(ctx)
+}
+
+// Retrieve the Impersonation struct, nil when the user is acting for themselves
+func (app *application) contextGetImpersonation(r *http.Request) *data.Impersonation {
+	impersonation, ok := r.Context().Value(impersonationContextKey).(*data.Impersonation)
+	if !ok {
+		return nil
+	}
+	return impersonation
+}
+
+// delegatedRequest() reports whether the request is made on the user's behalf by an API key, a third-party
+// application or an impersonating administrator rather than by the user themselves
+func (app *application) delegatedRequest(r *http.Request) bool {
+	return app.contextGetAPIKey(r) != nil || app.contextGetOAuthToken(r) != nil || app.contextGetImpersonation(r) != nil
+}
+
+// Method to add the workspace the request is made in to the context
+func (app *application) contextSetWorkspace(r *http.Request, workspaceID int64) *http.Request {
+	ctx := context.WithValue(r.Context(), workspaceContextKey, workspaceID)
+	return r.WithContext(ctx)
+}
+
+// Retrieve the workspace id, 0 when no workspace was selected
+func (app *application) contextGetWorkspace(r *http.Request) int64 {
+	workspaceID, ok := r.Context().Value(workspaceContextKey).(int64)
+	if !ok {
+		return 0
+	}
+	return workspaceID
+}
+
+// Method to add the OAuth access token a third-party application is using to the context
+func (app *application) contextSetOAuthToken(r *http.Request, token *data.OAuthToken) *http.Request {
+	ctx := context.WithValue(r.Context(), oauthTokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// Retrieve the OAuthToken struct, nil when the request was not made by a third-party application
+func (app *application) contextGetOAuthToken(r *http.Request) *data.OAuthToken {
+	token, ok := r.Context().Value(oauthTokenContextKey).(*data.OAuthToken)
+	if !ok {
+		return nil
+	}
+	return token
+}
+
+// Method to add the request id and an empty requestInfo to the context
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	ctx = context.WithValue(ctx, requestInfoContextKey, &requestInfo{})
+	return r.WithContext(ctx)
+}
+
+// Retrieve the request id, empty when the request has none
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// Retrieve the requestInfo, nil when the request has none
+func (app *application) contextGetRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoContextKey).(*requestInfo)
+	return info
+}
@@ -3,11 +3,15 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
+		"request_id":     app.contextGetRequestID(r),
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
 	})
@@ -72,6 +76,19 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+// The rate limiter can't be reached and is configured to fail closed
+func (app *application) rateLimiterUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the server is unable to check the rate limit, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+// Too many failed logins
+func (app *application) loginLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 // Invalid credentials
 func (app *application) invalidCredntialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
@@ -85,6 +102,19 @@ func (app *application) invalidAuthenticationTokenReponse(w http.ResponseWriter,
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+// Invalid API key
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("WWW-Authenticate", "ApiKey")
+	message := "invalid, expired or missing API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// API key used outside of its IP allowlist
+func (app *application) apiKeyIPNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this API key may not be used from your IP address"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 // Unauthorized access
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
@@ -102,3 +132,49 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user accound does not have the necessary permission to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+// Two-factor authentication is already switched on
+func (app *application) mfaAlreadyEnabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is already enabled for this account"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// Wrong or reused TOTP/recovery code
+func (app *application) invalidSecondFactorResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid, expired or already used two-factor authentication code"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Workspace scoped route called without selecting a workspace
+func (app *application) workspaceRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this resource belongs to a workspace, select one with the X-Workspace-ID header or the /v1/workspaces/:id prefix"
+	app.errorResponse(w, r, http.StatusBadRequest, message)
+}
+
+// Change that would leave a shared workspace without an owner
+func (app *application) lastWorkspaceOwnerResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a workspace must keep at least one owner"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// Identity provider login that could not be completed
+func (app *application) oidcLoginFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the login with the identity provider could not be completed, please try again"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Identity provider that did not verify the email address
+func (app *application) oidcUnverifiedEmailResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the identity provider did not supply a verified email address"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// The OAuth endpoints report errors in the format clients expect from RFC 6749
+func (app *application) oauthErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	env := envelope{"error": code, "error_description": description}
+	err := app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -3,25 +3,184 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"mgomez.net/internal/health"
+	"mgomez.net/internal/ratelimit"
 )
 
+// newHealthChecks() registers the dependencies checked before the server is reported ready
+func (app *application) newHealthChecks() *health.Registry {
+	checks := health.NewRegistry()
+	checks.Register(
+		health.Check{
+			Name:     "database",
+			Critical: true,
+			Timeout:  2 * time.Second,
+			Run: func(ctx context.Context) (string, error) {
+				return "", app.db.PingContext(ctx)
+			},
+		},
+		health.Check{
+			Name:     "migrations",
+			Critical: true,
+			Timeout:  2 * time.Second,
+			Run:      app.checkMigrations,
+		},
+		//every probe would otherwise open a connection to the mail server
+		health.Check{
+			Name:    "smtp",
+			Timeout: 3 * time.Second,
+			Run: health.Cached(30*time.Second, func(ctx context.Context) (string, error) {
+				return "", app.live().mailer.Ping(ctx)
+			}),
+		},
+		health.Check{
+			Name:    "temp_dir",
+			Timeout: time.Second,
+			Run:     checkTempDir,
+		},
+	)
+
+	//Requests are turned away when the shared limiter fails closed, so it is only critical then
+	if redis, ok := app.limiter.(*ratelimit.Redis); ok {
+		checks.Register(health.Check{
+			Name:     "rate_limiter",
+			Critical: !app.config.limiter.failOpen,
+			Timeout:  time.Second,
+			Run: func(ctx context.Context) (string, error) {
+				return "", redis.Ping(ctx)
+			},
+		})
+	}
+	return checks
+}
+
+// checkMigrations() reports the schema version, failing if it isn't the one this build expects
+// or a migration was left half applied
+func (app *application) checkMigrations(ctx context.Context) (string, error) {
+	current, _, err := app.migrator.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "version " + strconv.FormatInt(current, 10), app.migrator.Check(ctx)
+}
+
+// checkTempDir() makes sure temporary files can still be written, a full disk shows up here first
+func checkTempDir(ctx context.Context) (string, error) {
+	dir := os.TempDir()
+	f, err := os.CreateTemp(dir, "healthcheck-*")
+	if err != nil {
+		return dir, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write([]byte("ok"))
+	if err != nil {
+		f.Close()
+		return dir, err
+	}
+	return dir, f.Close()
+}
+
+// setDraining() marks the server as shutting down, readiness fails from then on so load
+// balancers stop sending new requests
+func (app *application) setDraining() {
+	atomic.StoreInt32(&app.draining, 1)
+}
+
+func (app *application) isDraining() bool {
+	return atomic.LoadInt32(&app.draining) == 1
+}
+
+// healthcheckHandler() reports the server is ready, kept for existing clients of /v1/healthcheck
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
-	//create a map that'll hold healtcheck data
+	app.readinessHandler(w, r)
+}
+
+// livenessHandler() reports the process is running and able to answer, without touching any dependency
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	status := "available"
+	if app.isDraining() {
+		status = "draining"
+	}
 	data := envelope{
-		"status": "available",
+		"status": status,
 		"system_info": map[string]string{
 			"environment": app.config.env,
 			"version":     version,
 		},
 	}
-
-	//covering map -> JSON object
 	err := app.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showHealthDetails() reports whether the caller may see the details of the checks. Errors carry
+// hostnames, ports and driver messages, so only administrators get them
+func (app *application) showHealthDetails(r *http.Request) bool {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		return false
+	}
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil || !permissions.Include("users:admin") {
+		return false
+	}
+	if key := app.contextGetAPIKey(r); key != nil && !key.Permissions.Include("users:admin") {
+		return false
+	}
+	if token := app.contextGetOAuthToken(r); token != nil && !token.Scopes.Include("users:admin") {
+		return false
+	}
+	return true
+}
+
+// readinessHandler() runs the dependency checks, answering 503 when a critical one fails or the
+// server is shutting down. Failing checks are logged, their details are only shown to administrators
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := app.health.Run(r.Context())
+
+	details := app.showHealthDetails(r)
+	for i, result := range report.Checks {
+		if result.Status != "up" {
+			app.logger.PrintError(errors.New(result.Error), map[string]string{
+				"check":    result.Name,
+				"critical": strconv.FormatBool(result.Critical),
+			})
+		}
+		if !details {
+			report.Checks[i].Detail = ""
+			report.Checks[i].Error = ""
+		}
+	}
+
+	status, code := "available", http.StatusOK
+	switch {
+	case app.isDraining():
+		status, code = "draining", http.StatusServiceUnavailable
+	case !report.Healthy:
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
 
-	//will print error if any
+	data := envelope{
+		"status": status,
+		"checks": report.Checks,
+		"system_info": map[string]string{
+			"environment": app.config.env,
+			"version":     version,
+		},
+	}
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+	err := app.writeJSON(w, code, data, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -149,12 +150,72 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return intValue
 }
 
+// The readBool() method converts a string value from the query string to a boolean.
+// nil is returned when the key is missing, a validation error is added if the value is not a boolean
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	//Get the value
+	value := qs.Get(key)
+	if value == "" {
+		return nil
+	}
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+	return &boolValue
+}
+
+// clientIP() returns the IP address the request was sent from. When it came through one of our
+// proxies the address is taken from X-Forwarded-For, reading from the right so a client can't forge it
+func (app *application) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if !app.trustedProxy(ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !app.trustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// trustedProxy() checks if the address belongs to one of our proxies
+func (app *application) trustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range app.config.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // background accepts a function as it's parameter
 func (app *application) background(fn func()) {
 	//increament the WaitGroup counter
 	app.wg.Add(1)
+	app.metrics.background.Inc()
 	go func() {
 		defer app.wg.Done()
+		defer app.metrics.background.Dec()
 		//recover from panics
 		defer func() {
 			if err := recover(); err != nil {
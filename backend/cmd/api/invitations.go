@@ -0,0 +1,212 @@
+// Filename: MyReference/backend/cmd/api/invitations.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mgomez.net/internal/data"
+	"mgomez.net/internal/validator"
+)
+
+// createInvitationHandler() emails an invitation to join the service, and optionally one of the inviter's workspaces
+func (app *application) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email         string `json:"email"`
+		WorkspaceID   int64  `json:"workspace_id"`
+		WorkspaceRole string `json:"workspace_role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	inviter := app.contextGetUser(r)
+
+	invitation := &data.Invitation{
+		Email:         input.Email,
+		InvitedBy:     inviter.ID,
+		WorkspaceID:   input.WorkspaceID,
+		WorkspaceRole: input.WorkspaceRole,
+	}
+
+	v := validator.New()
+	if data.ValidateInvitation(v, invitation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	//Only owners can bring new members into a workspace
+	workspaceName := ""
+	if invitation.WorkspaceID != 0 {
+		workspace, err := app.models.Workspaces.Get(invitation.WorkspaceID, inviter.ID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if err != nil || workspace.Role != data.WorkspaceOwner {
+			v.AddError("workspace_id", "must be a workspace you own")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		workspaceName = workspace.Name
+	}
+
+	token, err := app.models.Invitations.New(invitation, app.config.invitationTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"inviterName":     inviter.Name,
+			"invitationToken": token.Plaintext,
+			"workspaceName":   workspaceName,
+			"expiry":          invitation.Expiry.Format(time.RFC1123),
+		}
+		err := app.sendMail(r.Context(), invitation.Email, "user_invitation.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/invitations/%d", invitation.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invitation": invitation}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listInvitationsHandler() returns the invitations that have not been accepted, revoked or expired
+func (app *application) listInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitations, err := app.models.Invitations.GetAllPending()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invitations": invitations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeInvitationHandler() cancels a pending invitation so its token can no longer be used
+func (app *application) revokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Invitations.Revoke(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "invitation successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// acceptInvitationHandler() uses an invitation token to create an account, or to link an existing one.
+// The token was delivered to the address so a new account is activated straight away, an existing
+// account keeps its activation status so a deactivated one stays deactivated
+func (app *application) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	invitation, err := app.models.Invitations.GetForToken(input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	//Link the invitation to an existing account, otherwise build a new one from the input
+	user, err := app.models.WithContext(r.Context()).Users.GetByEmail(invitation.Email)
+	created := false
+	switch {
+	case err == nil:
+		//an existing account keeps its activation status
+	case errors.Is(err, data.ErrRecordNotFound):
+		created = true
+		user = &data.User{
+			Name:      input.Name,
+			Email:     invitation.Email,
+			Activated: true,
+		}
+		err = user.Password.Set(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if data.ValidateUser(v, user); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	default:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	//The invitation is used up together with creating the account and joining the workspace,
+	//so it can't be accepted twice and stays usable when a step fails
+	err = app.models.Invitations.Accept(invitation, user, app.defaultRoles()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			v.AddError("token", "invalid or expired invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrLastOwner):
+			app.lastWorkspaceOwnerResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	err = app.writeJSON(w, status, envelope{"user": user, "invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,172 @@
+// Filename: MyReference/backend/cmd/api/lockout.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"mgomez.net/internal/data"
+	"mgomez.net/internal/validator"
+)
+
+// accountLockoutPolicy() returns the lockout settings applied per account
+func (app *application) accountLockoutPolicy() data.LockoutPolicy {
+	return data.LockoutPolicy{
+		Threshold:   app.config.lockout.threshold,
+		Window:      app.config.lockout.window,
+		Duration:    app.config.lockout.duration,
+		MaxDuration: app.config.lockout.maxDuration,
+	}
+}
+
+// ipLockoutPolicy() returns the lockout settings applied per IP address
+func (app *application) ipLockoutPolicy() data.LockoutPolicy {
+	policy := app.accountLockoutPolicy()
+	policy.Threshold = app.config.lockout.ipThreshold
+	return policy
+}
+
+// loginLockedFor() returns how much longer the longest lockout among the keys lasts
+func (app *application) loginLockedFor(keys ...string) (time.Duration, error) {
+	var remaining time.Duration
+	for _, key := range keys {
+		attempt, err := app.models.LoginAttempts.Get(key)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				continue
+			default:
+				return 0, err
+			}
+		}
+		if attempt.IsLocked() {
+			if left := time.Until(*attempt.LockedUntil); left > remaining {
+				remaining = left
+			}
+		}
+	}
+	return remaining, nil
+}
+
+// recordLoginFailure() counts a failed login against the account and the client IP.
+// When the account becomes locked its owner (if there is one) is emailed an unlock token
+func (app *application) recordLoginFailure(r *http.Request, email string, user *data.User) error {
+	_, err := app.models.LoginAttempts.RecordFailure(data.IPAttemptKey(app.clientIP(r)), app.ipLockoutPolicy())
+	if err != nil {
+		return err
+	}
+
+	policy := app.accountLockoutPolicy()
+	attempt, err := app.models.LoginAttempts.RecordFailure(data.AccountAttemptKey(email), policy)
+	if err != nil {
+		return err
+	}
+
+	//Only email the user the first time the threshold is crossed
+	if user == nil || attempt.LockedUntil == nil || attempt.Failures != policy.Threshold {
+		return nil
+	}
+
+	token, err := app.models.WithContext(r.Context()).Tokens.New(user.ID, policy.MaxDuration, data.ScopeUnlock)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"unlockToken": token.Plaintext,
+			"lockedUntil": attempt.LockedUntil.Format(time.RFC1123),
+		}
+		err := app.sendMail(r.Context(), user.Email, "user_unlock.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+	return nil
+}
+
+// unlockUserHandler() clears an account lockout with the token from the unlock email
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.WithContext(r.Context()).Users.GetForToken(data.ScopeUnlock, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unlock token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	//The lockout may have already expired, that is fine
+	err = app.models.LoginAttempts.Reset(data.AccountAttemptKey(user.Email))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.WithContext(r.Context()).Tokens.DeleteAllForUsers(data.ScopeUnlock, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "account successfully unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listLockoutsHandler() shows administrators every account and IP address that is locked out
+func (app *application) listLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := app.models.LoginAttempts.GetAllLocked()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lockouts": lockouts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteLockoutHandler() lets an administrator lift a lockout early
+func (app *application) deleteLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	key := params.ByName("key")
+
+	err := app.models.LoginAttempts.Reset(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "lockout successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
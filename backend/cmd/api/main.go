@@ -4,91 +4,155 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
-	"strings"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+	"mgomez.net/internal/authz"
+	"mgomez.net/internal/cache"
 	"mgomez.net/internal/data"
+	"mgomez.net/internal/health"
 	"mgomez.net/internal/jsonlog.go"
-	"mgomez.net/internal/mailer"
+	"mgomez.net/internal/migrate"
+	"mgomez.net/internal/oidc"
+	"mgomez.net/internal/ratelimit"
+	"mgomez.net/internal/tracing"
 )
 
 // Version number
 const version = "1.0.1"
 
-// configuration settings
-type config struct {
-	port int
-	env  string
-	db   struct {
-		dsn          string
-		maxOpenConns int
-		maxIdleConns int
-		maxIdleTime  string
-	}
-	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
-	}
-	smtp struct {
-		host     string
-		port     int
-		username string
-		password string
-		sender   string
-	}
-	cors struct {
-		trustedOrigins []string
-	}
-}
-
 // Dependency injection
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	//the settings at startup, those that can be reloaded are read through live()
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	db       *sql.DB
+	oidc     *oidc.Provider
+	cache    *cache.Cache
+	limiter  ratelimit.Limiter
+	metrics  *appMetrics
+	policy   *authz.Policy
+	tracer   *tracing.Tracer
+	health   *health.Registry
+	migrator *migrate.Migrator
+	//set to 1 once shutdown has begun
+	draining int32
+	//holds a *liveConfig, see live()
+	liveConfig atomic.Value
+	reloadMu   sync.Mutex
+	wg         sync.WaitGroup
 }
 
 func main() {
-	var cfg config
-
-	//reading the flags
-	flag.IntVar(&cfg.port, "port", 4000, "API server port")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development | staging | production)")
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("MREF_DB_DSN"), "PostgreSQL DSN") //Remember to change the environment variable
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
-
-	//flags for the rate limiter
-	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum request per second")
-	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
-	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Rate limiter enabledS")
-
-	//These are flags for the mailer
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "smtp.mailtrap.io", "SMTP host")
-	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", "148ede64e823ea", "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", "50a32fd39278fe", "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "MyReference <no-reply@MyReference.sophia.net>", "SMPT sender")
-
-	//Use the flag.func() function to parse our trusted origins flag form a string to a []string
-	flag.Func("cors-trusted-origins", "Trusted CORS origin (space separated)", func(val string) error {
-		cfg.cors.trustedOrigins = strings.Fields(val)
-		return nil
-	})
-
-	flag.Parse()
-
 	//creating logger
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	//Read the settings from the defaults, config file, environment and command line
+	cfg, settings, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	//settings are printed even when invalid, to show where a bad value came from
+	if cfg.printConfig && settings != nil {
+		printConfig(os.Stdout, cfg, settings)
+	}
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if cfg.printConfig {
+		return
+	}
+	level, _ := jsonlog.ParseLevel(cfg.logLevel)
+	logger.SetLevel(level)
+	logger.PrintInfo("configuration loaded", changedSettings(settings))
+
+	//The migrate subcommand manages the schema and exits without starting the server
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "":
+	case "migrate":
+		db, err := openDB(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		err = runMigrate(db, logger, args[1:])
+		db.Close()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown command %q", args[0]), nil)
+	}
+
+	//Choose the algorithm new passwords are hashed with
+	hasher, err := newPasswordHasher(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	data.SetPasswordHasher(hasher)
+
+	//Set up the rules new passwords must follow
+	policy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	data.SetPasswordPolicy(policy)
+	if policy.Breached != nil {
+		logger.PrintInfo("breached password list loaded", map[string]string{
+			"hashes": strconv.Itoa(policy.Breached.Len()),
+		})
+	}
+
+	//Choose where rate limit budgets are kept
+	limiter, err := newLimiter(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if redis, ok := limiter.(*ratelimit.Redis); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = redis.Ping(ctx)
+		cancel()
+		if err != nil && !cfg.limiter.failOpen {
+			logger.PrintFatal(err, nil)
+		}
+		if err != nil {
+			logger.PrintError(err, map[string]string{"limiter": "redis unreachable, failing open"})
+		}
+	}
+
+	//Set up where request traces are exported
+	tracer, err := newTracer(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	//Discover the identity provider used for single sign-on
+	var provider *oidc.Provider
+	if cfg.oidc.issuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err = oidc.Discover(ctx, cfg.oidc.issuer, cfg.oidc.clientID, cfg.oidc.clientSecret, cfg.oidc.redirectURL)
+		cancel()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		logger.PrintInfo("openid connect provider discovered", map[string]string{
+			"issuer": provider.Issuer,
+		})
+	}
+
 	//create the connection pool
 	db, err := openDB(cfg)
 	if err != nil {
@@ -98,12 +162,37 @@ func main() {
 	defer db.Close()
 	//Log the successful connection pool
 	logger.PrintInfo("database connection pool established", nil)
+
+	//Refuse to serve against a schema this build wasn't written for
+	migrator, err := checkSchema(cfg, db, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	//Cache the lookups made on every request, in memory unless a shared store is plugged in
+	var c *cache.Cache
+	if cfg.cache.size > 0 {
+		c = cache.New(cache.NewLRU(cfg.cache.size), cfg.cache.ttl)
+	}
 	//instance of app struct
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:   cfg,
+		logger:   logger,
+		models:   data.NewModels(db, c),
+		db:       db,
+		cache:    c,
+		limiter:  limiter,
+		metrics:  newMetrics(db, c),
+		oidc:     provider,
+		policy:   newPolicy(),
+		tracer:   tracer,
+		migrator: migrator,
+	}
+	app.setLive(cfg, settings)
+	app.health = app.newHealthChecks()
+	err = app.checkDefaultRole()
+	if err != nil {
+		logger.PrintFatal(err, nil)
 	}
 	//Call app.server() to start the server
 	err = app.serve()
@@ -136,3 +225,55 @@ func openDB(cfg config) (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+// newPasswordHasher() returns the hasher selected by the password flags
+func newPasswordHasher(cfg config) (data.PasswordHasher, error) {
+	switch cfg.password.hasher {
+	case "argon2id":
+		if cfg.password.memory < 8*1024 || cfg.password.iterations < 1 || cfg.password.parallelism < 1 || cfg.password.parallelism > 255 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+		return data.Argon2idHasher{
+			Memory:      uint32(cfg.password.memory),
+			Iterations:  uint32(cfg.password.iterations),
+			Parallelism: uint8(cfg.password.parallelism),
+			SaltLength:  16,
+			KeyLength:   32,
+		}, nil
+	case "bcrypt":
+		if cfg.password.bcryptCost < bcrypt.MinCost || cfg.password.bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return data.BcryptHasher{Cost: cfg.password.bcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", cfg.password.hasher)
+	}
+}
+
+// newLimiter() returns the rate limiter backend selected by the limiter flags
+func newLimiter(cfg config) (ratelimit.Limiter, error) {
+	switch cfg.limiter.backend {
+	case "memory":
+		return ratelimit.NewMemory(), nil
+	case "redis":
+		return ratelimit.NewRedis(cfg.limiter.redis.addr, cfg.limiter.redis.password, cfg.limiter.redis.timeout, 16), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter backend %q", cfg.limiter.backend)
+	}
+}
+
+// newPasswordPolicy() returns the policy selected by the password flags, loading the breached password list if one is configured
+func newPasswordPolicy(cfg config) (data.PasswordPolicy, error) {
+	policy := data.PasswordPolicy{
+		MinEntropy:         cfg.password.minEntropy,
+		RejectPersonalInfo: cfg.password.personal,
+	}
+	if cfg.password.breached != "" {
+		breached, err := data.LoadBreachedPasswords(cfg.password.breached)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
@@ -0,0 +1,123 @@
+// Filename: MyReference/backend/cmd/api/metrics.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"mgomez.net/internal/cache"
+	"mgomez.net/internal/metrics"
+	"mgomez.net/internal/tracing"
+)
+
+// appMetrics holds the metrics the application updates, the rest are read when scraped
+type appMetrics struct {
+	registry    *metrics.Registry
+	requests    *metrics.CounterVec
+	duration    *metrics.HistogramVec
+	inFlight    *metrics.Gauge
+	rateLimited *metrics.CounterVec
+	background  *metrics.Gauge
+	mail        *metrics.CounterVec
+}
+
+// newMetrics() registers the application, database pool, cache and runtime metrics
+func newMetrics(db *sql.DB, c *cache.Cache) *appMetrics {
+	m := &appMetrics{
+		registry:    metrics.NewRegistry(),
+		requests:    metrics.NewCounterVec("http_requests_total", "Number of HTTP requests by route and status.", "method", "route", "status"),
+		duration:    metrics.NewHistogramVec("http_request_duration_seconds", "Time taken to respond to HTTP requests.", metrics.DefaultBuckets, "method", "route", "status"),
+		inFlight:    metrics.NewGauge("http_requests_in_flight", "Number of HTTP requests being served."),
+		rateLimited: metrics.NewCounterVec("rate_limit_rejections_total", "Number of requests rejected by the rate limiter.", "policy"),
+		background:  metrics.NewGauge("background_goroutines", "Number of background tasks still running."),
+		mail:        metrics.NewCounterVec("mail_sent_total", "Number of emails sent by template and result.", "template", "result"),
+	}
+	m.registry.Register(m.requests, m.duration, m.inFlight, m.rateLimited, m.background, m.mail)
+
+	//the connection pool keeps its own statistics
+	stat := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 {
+			return fn(db.Stats())
+		}
+	}
+	m.registry.Register(
+		metrics.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.", stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })),
+		metrics.NewGaugeFunc("db_open_connections", "Number of established connections, in use and idle.", stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) })),
+		metrics.NewGaugeFunc("db_in_use_connections", "Number of connections currently in use.", stat(func(s sql.DBStats) float64 { return float64(s.InUse) })),
+		metrics.NewGaugeFunc("db_idle_connections", "Number of idle connections.", stat(func(s sql.DBStats) float64 { return float64(s.Idle) })),
+		metrics.NewCounterFunc("db_wait_count_total", "Number of times a connection had to be waited for.", stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) })),
+		metrics.NewCounterFunc("db_wait_duration_seconds_total", "Total time spent waiting for a connection.", stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })),
+		metrics.NewCounterFunc("db_max_idle_closed_total", "Number of connections closed because of the idle limit.", stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })),
+		metrics.NewCounterFunc("db_max_idle_time_closed_total", "Number of connections closed because of the idle time limit.", stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) })),
+	)
+
+	//the token and permission cache
+	m.registry.Register(
+		metrics.NewCounterFunc("cache_hits_total", "Number of lookups answered by the cache.", func() float64 { return float64(c.Stats().Hits) }),
+		metrics.NewCounterFunc("cache_misses_total", "Number of lookups that went to the database.", func() float64 { return float64(c.Stats().Misses) }),
+		metrics.NewCounterFunc("cache_errors_total", "Number of failed cache operations.", func() float64 { return float64(c.Stats().Errors) }),
+	)
+
+	m.registry.Register(metrics.NewRuntimeCollector())
+	return m
+}
+
+// metricsHandler() writes the metrics in the Prometheus text format
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	app.metrics.registry.Write(w)
+}
+
+// patternRouter registers routes on httprouter, recording the pattern each one was registered with
+// so the metrics are labelled by route rather than by URL
+type patternRouter struct {
+	*httprouter.Router
+}
+
+// HandlerFunc() registers the handler for the method and pattern
+func (router patternRouter) HandlerFunc(method, pattern string, handler http.HandlerFunc) {
+	router.Router.HandlerFunc(method, pattern, func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+			info.route = pattern
+		}
+		handler(w, r)
+	})
+}
+
+// instrument() counts and times every request by method, route and status
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		app.metrics.inFlight.Inc()
+		defer app.metrics.inFlight.Dec()
+
+		rw := newResponseRecorder(w)
+		next.ServeHTTP(rw, r)
+
+		status := strconv.Itoa(rw.status)
+		route := app.routeLabel(r)
+		app.metrics.requests.Inc(r.Method, route, status)
+		app.metrics.duration.Observe(time.Since(start).Seconds(), r.Method, route, status)
+	})
+}
+
+// sendMail() sends an email from a template, counting successes and failures. ctx only links the
+// span to the trace of the request that queued the email, it is not used to cancel the send
+func (app *application) sendMail(ctx context.Context, recipient, templateFile string, data interface{}) error {
+	_, span := tracing.StartChild(ctx, "mail "+templateFile, tracing.KindClient)
+	defer span.Finish()
+	span.SetAttribute("mail.template", templateFile)
+
+	err := app.live().mailer.Send(recipient, templateFile, data)
+	if err != nil {
+		span.RecordError(err)
+		app.metrics.mail.Inc(templateFile, "failure")
+		return err
+	}
+	app.metrics.mail.Inc(templateFile, "success")
+	return nil
+}
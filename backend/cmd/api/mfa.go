@@ -0,0 +1,288 @@
+// Filename: MyReference/backend/cmd/api/mfa.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"mgomez.net/internal/data"
+	"mgomez.net/internal/totp"
+	"mgomez.net/internal/validator"
+)
+
+// The issuer shown by authenticator apps next to the account name
+const totpIssuer = "MyReference"
+
+// How long a challenge token from a password login can be exchanged for
+const mfaChallengeTTL = 5 * time.Minute
+
+// enrolTOTPHandler() generates a new secret for the user, 2FA stays disabled until a code is verified
+func (app *application) enrolTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	//Only the user themselves may change their second factor
+	if app.delegatedRequest(r) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.MFA.Enrol(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.mfaAlreadyEnabledResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	enrolment := envelope{
+		"secret": secret,
+		"uri":    totp.URI(totpIssuer, user.Email, secret),
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"totp": enrolment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// enableTOTPHandler() verifies the first code from the authenticator app and switches 2FA on
+func (app *application) enableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	//Only the user themselves may change their second factor
+	if app.delegatedRequest(r) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	enrolment, err := app.models.MFA.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if enrolment.Enabled {
+		app.mfaAlreadyEnabledResponse(w, r)
+		return
+	}
+
+	//Check the code
+	v := validator.New()
+	step, ok := totp.Validate(enrolment.Secret, input.Code, time.Now(), 1, enrolment.LastUsedStep)
+	if !ok {
+		v.AddError("code", "invalid or expired code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.MFA.UseStep(user.ID, step)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.MFA.Enable(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	//Hand out the recovery codes, they are only ever shown once
+	codes, err := app.models.MFA.NewRecoveryCodes(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// disableTOTPHandler() switches 2FA off, a valid code or recovery code is required
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	//Only the user themselves may change their second factor
+	if app.delegatedRequest(r) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	ok, err := app.verifySecondFactor(user.ID, input.Code, input.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !ok {
+		app.invalidSecondFactorResponse(w, r)
+		return
+	}
+
+	err = app.models.MFA.Disable(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createMFAAuthenticationTokenHandler() exchanges a challenge token and a code for an authentication token
+func (app *application) createMFAAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.ChallengeToken)
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	//Get the user the challenge was issued to
+	user, err := app.models.WithContext(r.Context()).Users.GetForToken(data.ScopeMFAChallenge, input.ChallengeToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredntialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	//Wrong codes count towards the account lockout just like wrong passwords
+	lockedFor, err := app.loginLockedFor(data.AccountAttemptKey(user.Email), data.IPAttemptKey(app.clientIP(r)))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if lockedFor > 0 {
+		app.loginLockedResponse(w, r, lockedFor)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(user.ID, input.Code, input.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredntialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !ok {
+		err = app.recordLoginFailure(r, user.Email, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.invalidSecondFactorResponse(w, r)
+		return
+	}
+
+	//The challenge can only be used once
+	err = app.models.WithContext(r.Context()).Tokens.DeleteAllForUsers(data.ScopeMFAChallenge, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.WithContext(r.Context()).Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifySecondFactor() checks a TOTP code, or a recovery code when one is supplied.
+// Codes that were already used are rejected
+func (app *application) verifySecondFactor(userID int64, code, recoveryCode string) (bool, error) {
+	enrolment, err := app.models.MFA.Get(userID)
+	if err != nil {
+		return false, err
+	}
+	if !enrolment.Enabled {
+		return false, data.ErrRecordNotFound
+	}
+
+	if recoveryCode != "" {
+		return app.models.MFA.UseRecoveryCode(userID, recoveryCode)
+	}
+
+	step, ok := totp.Validate(enrolment.Secret, code, time.Now(), 1, enrolment.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+	return app.models.MFA.UseStep(userID, step)
+}
+
+// mfaEnabled() reports whether the user has to complete a 2FA challenge when logging in
+func (app *application) mfaEnabled(userID int64) (bool, error) {
+	enrolment, err := app.models.MFA.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return enrolment.Enabled, nil
+}
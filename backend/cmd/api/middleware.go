@@ -3,19 +3,128 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"golang.org/x/time/rate"
 	"mgomez.net/internal/data"
+	"mgomez.net/internal/ratelimit"
+	"mgomez.net/internal/tracing"
 	"mgomez.net/internal/validator"
 )
 
+// requestID() gives every request an id, taken from the X-Request-ID header when the caller
+// or a proxy sent a usable one, and sends it back so a client can quote it
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			b := make([]byte, 16)
+			_, err := rand.Read(b)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestID(r, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID() accepts ids of up to 128 letters, digits and -_.: so they are safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// logRequest() writes one access log line for every request once it has been answered
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := newResponseRecorder(w)
+
+		next.ServeHTTP(rw, r)
+
+		properties := map[string]string{
+			"request_id":  app.contextGetRequestID(r),
+			"method":      r.Method,
+			"route":       app.routeLabel(r),
+			"status":      strconv.Itoa(rw.status),
+			"bytes":       strconv.Itoa(rw.size),
+			"duration_ms": strconv.FormatFloat(float64(time.Since(start).Microseconds())/1000, 'f', 3, 64),
+			"remote_ip":   app.clientIP(r).String(),
+		}
+		if info := app.contextGetRequestInfo(r); info != nil && info.userID != 0 {
+			properties["user_id"] = strconv.FormatInt(info.userID, 10)
+		}
+		if span := tracing.FromContext(r.Context()); span != nil {
+			properties["trace_id"] = span.Context.TraceID.String()
+		}
+		app.logger.PrintInfo("request", properties)
+	})
+}
+
+// routeLabel() returns the pattern of the route that handled the request.
+// Requests answered by middleware or matching no route share one label
+func (app *application) routeLabel(r *http.Request) string {
+	if info := app.contextGetRequestInfo(r); info != nil && info.route != "" {
+		return info.route
+	}
+	return "unmatched"
+}
+
+// responseRecorder wraps a ResponseWriter to remember the status code and size of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+// newResponseRecorder() wraps w, reusing the recorder when an outer middleware already wrapped it
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	if rw, ok := w.(*responseRecorder); ok {
+		return rw
+	}
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	return n, err
+}
+
+// Unwrap() lets http.ResponseController reach the underlying ResponseWriter
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -28,65 +137,89 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) rateLimit(next http.Handler) http.Handler {
-	//Create a client type
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
-
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
-
-	//Launch a background goroutine that removes old entries
-	//from the clients map once every minute
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			//Lock before starting to clean
-			mu.Lock()
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
-			mu.Unlock()
-		}
-	}()
+// loginRoutes accept passwords and codes, so they get the stricter login budget
+var loginRoutes = map[string]bool{
+	"POST /v1/tokens/authentication": true,
+	"POST /v1/tokens/mfa":            true,
+	"POST /v1/oauth/authorize":       true,
+}
 
+// rateLimitIP() gives every IP address a budget that is spent before the credentials are checked,
+// so guessing tokens or API keys is limited even though every guess is turned away by authenticate
+func (app *application) rateLimitIP(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := &app.live().config
+		policy := ratelimit.Policy{Name: "ip", RPS: cfg.limiter.ipRPS, Burst: cfg.limiter.ipBurst}
+		if cfg.limiter.enabled && !app.spendRateLimit(w, r, policy, "ip:"+app.clientIP(r).String()) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		if app.config.limiter.enabled {
-			//Get the ip address of the request
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-				return
-			}
-			//lock()
-			mu.Lock()
-			//check if the IP address is in the map
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{limiter: rate.NewLimiter(
-					rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
-			}
-			//Update the last seen time of the client
-			clients[ip].lastSeen = time.Now()
-
-			//check if request allowed
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
-				app.rateLimitExceededResponse(w, r)
-				return
-			}
-			mu.Unlock()
+// rateLimit() gives every user, API key or anonymous IP address its own budget for each policy.
+// It runs after authenticate so signed in users are not limited by the address they share
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := &app.live().config
+		if cfg.limiter.enabled && !app.spendRateLimit(w, r, rateLimitPolicyFor(cfg, r), app.rateLimitKey(r)) {
+			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// spendRateLimit() spends one request of the key's budget and sets the rate limit headers.
+// If the request must be turned away the response is written and false returned
+func (app *application) spendRateLimit(w http.ResponseWriter, r *http.Request, policy ratelimit.Policy, key string) bool {
+	result, err := app.limiter.Allow(r.Context(), policy, key)
+	if err != nil {
+		//a shared limiter can be unreachable, either let requests through or turn them away
+		app.logError(r, err)
+		if !app.live().config.limiter.failOpen {
+			app.rateLimiterUnavailableResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	//let the client know how much of the budget is left, the route's own budget is set last
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(wholeSeconds(result.Reset)))
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(wholeSeconds(result.RetryAfter)))
+		app.metrics.rateLimited.Inc(policy.Name)
+		app.rateLimitExceededResponse(w, r)
+		return false
+	}
+	return true
+}
+
+// rateLimitPolicyFor() picks the budget for the route
+func rateLimitPolicyFor(cfg *config, r *http.Request) ratelimit.Policy {
+	if loginRoutes[r.Method+" "+r.URL.Path] {
+		return ratelimit.Policy{Name: "login", RPS: cfg.limiter.loginRPS, Burst: cfg.limiter.loginBurst}
+	}
+	return ratelimit.Policy{Name: "default", RPS: cfg.limiter.rps, Burst: cfg.limiter.burst}
+}
+
+// rateLimitKey() identifies who is spending the budget: the API key, the user, or the IP address
+func (app *application) rateLimitKey(r *http.Request) string {
+	if key := app.contextGetAPIKey(r); key != nil {
+		return fmt.Sprintf("key:%d", key.ID)
+	}
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+	return "ip:" + app.clientIP(r).String()
+}
+
+// wholeSeconds() rounds a duration up to whole seconds for the rate limit headers
+func wholeSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
 // Authentication
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -104,12 +237,67 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		//Check if the provided authorization header is in the right format
 		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		if len(headerParts) != 2 {
+			app.invalidAuthenticationTokenReponse(w, r)
+			return
+		}
+
+		//API keys used by scripts and CI are sent with their own scheme
+		if headerParts[0] == "ApiKey" {
+			r, ok := app.authenticateAPIKey(w, r, headerParts[1])
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		//Basic credentials are only used by OAuth clients at the OAuth endpoints, which check them themselves
+		if headerParts[0] == "Basic" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if headerParts[0] != "Bearer" {
 			app.invalidAuthenticationTokenReponse(w, r)
 			return
 		}
 		//Extract the token
 		token := headerParts[1]
+
+		//Access tokens issued to third-party applications are longer than our own tokens
+		if len(token) == data.OAuthTokenLength {
+			r, ok := app.authenticateOAuthToken(w, r, token)
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		//Support staff acting as the user send an impersonation token, which is told apart by its prefix
+		if strings.HasPrefix(token, data.ImpersonationTokenPrefix) {
+			v := validator.New()
+			if data.ValidateTokenPlaintext(v, strings.TrimPrefix(token, data.ImpersonationTokenPrefix)); !v.Valid() {
+				app.invalidCredntialsResponse(w, r)
+				return
+			}
+			r, user, err := app.authenticateImpersonation(r, token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidCredntialsResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetUser(r, user)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		//Validate the token
 		v := validator.New()
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
@@ -118,7 +306,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		//Retrieve details about the user
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.models.WithContext(r.Context()).Users.GetForToken(data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -136,6 +324,92 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// authenticateOAuthToken() authenticates a request made by a third-party application with an access token
+func (app *application) authenticateOAuthToken(w http.ResponseWriter, r *http.Request, plaintext string) (*http.Request, bool) {
+	token, user, err := app.models.OAuth.GetForToken(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			app.invalidCredntialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return r, false
+	}
+
+	r = app.contextSetOAuthToken(r, token)
+	r = app.contextSetUser(r, user)
+	return r, true
+}
+
+// authenticateImpersonation() looks up the user an impersonation token was issued for and
+// adds the audit record to the request context. Every impersonated request is logged
+func (app *application) authenticateImpersonation(r *http.Request, token string) (*http.Request, *data.User, error) {
+	user, err := app.models.WithContext(r.Context()).Users.GetForToken(data.ScopeImpersonation, token)
+	if err != nil {
+		return r, nil, err
+	}
+	impersonation, err := app.models.Impersonations.GetForToken(token)
+	if err != nil {
+		return r, nil, err
+	}
+
+	app.logger.PrintInfo("impersonated request", map[string]string{
+		"impersonation_id": strconv.FormatInt(impersonation.ID, 10),
+		"admin_id":         strconv.FormatInt(impersonation.AdminID, 10),
+		"user_id":          strconv.FormatInt(user.ID, 10),
+		"request_method":   r.Method,
+		"request_url":      r.URL.String(),
+	})
+
+	r = app.contextSetImpersonation(r, impersonation)
+	return r, user, nil
+}
+
+// authenticateAPIKey() looks up the owner of an API key and adds both to the request context.
+// It writes the error response itself and returns false if the key cannot be used
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, keyPlaintext string) (*http.Request, bool) {
+	//Validate the key
+	v := validator.New()
+	if data.ValidateAPIKeyPlaintext(v, keyPlaintext); !v.Valid() {
+		app.invalidAPIKeyResponse(w, r)
+		return r, false
+	}
+
+	//Retrieve the key and the user that owns it
+	key, user, err := app.models.APIKeys.GetForKey(keyPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAPIKeyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return r, false
+	}
+
+	//Check the key against its IP allowlist
+	if !key.AllowsIP(app.clientIP(r)) {
+		app.apiKeyIPNotAllowedResponse(w, r)
+		return r, false
+	}
+
+	//Record the usage in the background, at most once a minute per key
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > time.Minute {
+		app.background(func() {
+			err := app.models.APIKeys.Touch(key.ID)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetAPIKey(r, key)
+	return r, true
+}
+
 // Check for activated user
 func (app *application) requireAuthenitcatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -185,17 +459,214 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 			app.notPermittedResponse(w, r)
 			return
 		}
+		//API keys are restricted to the subset of permissions they were created with
+		if key := app.contextGetAPIKey(r); key != nil && !key.Permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		//and third-party applications to the scopes the user consented to
+		if token := app.contextGetOAuthToken(r); token != nil && !token.Scopes.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		//Workspace scoped permissions also need a membership role that grants them
+		if data.WorkspaceScoped(code) {
+			workspaceID := app.contextGetWorkspace(r)
+			if workspaceID == 0 {
+				app.workspaceRequiredResponse(w, r)
+				return
+			}
+			role, err := app.models.Workspaces.GetRole(workspaceID, user.ID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.notPermittedResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			if !data.WorkspaceRoleGrants(role, code) {
+				app.notPermittedResponse(w, r)
+				return
+			}
+		}
+		//and finally the request has to pass the authorization policy
+		if !app.authorize(w, r, code, nil) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	return app.requireActivatedUser(fn)
+}
+
+// requireWorkspaceRole() checks the user holds at least the given role in the workspace named by the :id parameter
+func (app *application) requireWorkspaceRole(minimum string, next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		//Workspaces are administered with the user's own credentials, the permission subset of an
+		//API key or the scopes of a third-party application don't cover them
+		if app.delegatedRequest(r) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		user := app.contextGetUser(r)
+		role, err := app.models.Workspaces.GetRole(id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.WorkspaceRoleAtLeast(role, minimum) {
+			app.notPermittedResponse(w, r)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 	return app.requireActivatedUser(fn)
 }
 
+// selectWorkspace() reads the workspace the request is made in from the X-Workspace-ID header or
+// from a /v1/workspaces/:id/... prefix. The prefix is stripped so the rest of the path is routed as usual
+func (app *application) selectWorkspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var workspaceID int64
+		if header := r.Header.Get("X-Workspace-ID"); header != "" {
+			id, err := strconv.ParseInt(header, 10, 64)
+			if err != nil || id < 1 {
+				app.badRequestResponse(w, r, errors.New("invalid X-Workspace-ID header"))
+				return
+			}
+			workspaceID = id
+		}
+
+		if id, path, ok := splitWorkspacePrefix(r.URL.Path); ok {
+			if workspaceID != 0 && workspaceID != id {
+				app.badRequestResponse(w, r, errors.New("the X-Workspace-ID header does not match the workspace in the URL"))
+				return
+			}
+			workspaceID = id
+			r = r.Clone(r.Context())
+			r.URL.Path = path
+			r.URL.RawPath = ""
+		}
+
+		if workspaceID != 0 {
+			r = app.contextSetWorkspace(r, workspaceID)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitWorkspacePrefix() turns /v1/workspaces/3/references/7 into 3 and /v1/references/7.
+// The workspace's own endpoints, /v1/workspaces/3 and /v1/workspaces/3/members, are left alone
+func splitWorkspacePrefix(path string) (int64, string, bool) {
+	const prefix = "/v1/workspaces/"
+	if !strings.HasPrefix(path, prefix) {
+		return 0, "", false
+	}
+	rest := path[len(prefix):]
+	slash := strings.IndexByte(rest, '/')
+	if slash < 0 {
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(rest[:slash], 10, 64)
+	if err != nil || id < 1 {
+		return 0, "", false
+	}
+	rest = rest[slash:]
+	if rest == "/" || rest == "/members" || strings.HasPrefix(rest, "/members/") {
+		return 0, "", false
+	}
+	return id, "/v1" + rest, true
+}
+
 // Enable CORS
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		//Setting the access-control-allow-origin-header
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		//The response depends on the origin, so caches must keep them apart
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		//find the trusted origin pattern the request came from
+		trusted := ""
+		cfg := &app.live().config
+		for _, pattern := range cfg.cors.trustedOrigins {
+			if originMatches(origin, pattern) {
+				trusted = pattern
+				break
+			}
+		}
+		if trusted == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		//credentials are never shared with an origin trusted through the catch-all
+		if cfg.cors.allowCredentials && trusted != "*" {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		//let browser clients read the request id and the rate limit headers
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
+
+		//Answer preflight requests here, they carry no credentials so never reach the handlers
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Workspace-ID, X-Request-ID")
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.cors.maxAge.Seconds())))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// originMatches() checks an origin against a trusted pattern. A pattern is an exact origin,
+// an origin with a wildcard for the subdomains like https://*.example.com, or * for any origin
+func originMatches(origin, pattern string) bool {
+	origin = strings.ToLower(origin)
+	pattern = strings.ToLower(pattern)
+	if pattern == "*" {
+		return true
+	}
+
+	i := strings.Index(pattern, "://*.")
+	if i == -1 {
+		return origin == pattern
+	}
+	//the scheme and the parent domain with its port must match exactly
+	prefix, suffix := pattern[:i+3], pattern[i+4:]
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(subdomain, "/:@")
+}
+
+// validOriginPattern() checks a trusted origin pattern is a scheme and host with nothing after it
+func validOriginPattern(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	u, err := url.Parse(strings.Replace(pattern, "://*.", "://wildcard.", 1))
+	return err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.User == nil
+}
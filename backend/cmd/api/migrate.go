@@ -0,0 +1,116 @@
+// Filename: MyReference/backend/cmd/api/migrate.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"mgomez.net/internal/jsonlog.go"
+	"mgomez.net/internal/migrate"
+	"mgomez.net/migrations"
+)
+
+const migrateUsage = "usage: api [flags] migrate up | down | status | goto VERSION | force VERSION"
+
+// runMigrate() runs the migrate subcommand, args are the words after "migrate"
+func runMigrate(db *sql.DB, logger *jsonlog.Logger, args []string) error {
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	//migrations can take a while, they are only cut off if something hangs
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		err = migrator.Up(ctx)
+	case args[0] == "down" && len(args) == 1:
+		err = migrator.Down(ctx)
+	case args[0] == "status" && len(args) == 1:
+		return printMigrationStatus(ctx, migrator)
+	case (args[0] == "goto" || args[0] == "force") && len(args) == 2:
+		target, convErr := strconv.ParseInt(args[1], 10, 64)
+		if convErr != nil || target < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if args[0] == "goto" {
+			err = migrator.Goto(ctx, target)
+		} else {
+			err = migrator.Force(ctx, target)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	current, _, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	logger.PrintInfo("database schema migrated", map[string]string{
+		"command": args[0],
+		"version": strconv.FormatInt(current, 10),
+	})
+	return nil
+}
+
+// printMigrationStatus() lists the migrations and which ones the database has
+func printMigrationStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, current, dirty, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+	for _, s := range statuses {
+		status := "pending"
+		switch {
+		case dirty && s.Version == current:
+			status = "dirty"
+		case s.Applied:
+			status = "applied"
+		}
+		fmt.Fprintf(tw, "%06d\t%s\t%s\n", s.Version, s.Name, status)
+	}
+	return tw.Flush()
+}
+
+// checkSchema() makes sure the database schema is the one this build was written for, applying
+// the pending migrations first when auto-migrate is on
+func checkSchema(cfg config, db *sql.DB, logger *jsonlog.Logger) (*migrate.Migrator, error) {
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if cfg.db.autoMigrate {
+		err = migrator.Up(ctx)
+		switch {
+		case errors.Is(err, migrate.ErrNoChange):
+		case err != nil:
+			return nil, err
+		default:
+			logger.PrintInfo("database schema migrated", map[string]string{
+				"version": strconv.FormatInt(migrator.Latest(), 10),
+			})
+		}
+	}
+	return migrator, migrator.Check(ctx)
+}
@@ -0,0 +1,556 @@
+// Filename: MyReference/backend/cmd/api/oauth.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"mgomez.net/internal/data"
+	"mgomez.net/internal/oidc"
+	"mgomez.net/internal/validator"
+)
+
+// How long an authorization code can be exchanged for, and how long access tokens last
+const (
+	oauthCodeTTL  = 5 * time.Minute
+	oauthTokenTTL = time.Hour
+)
+
+// The consent page is a plain form because the browser holds no API token, the user signs in on it
+var consentPage = template.Must(template.New("consent").Parse(`
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<title>MyReference</title>
+	</head>
+	<body>
+		{{if .Fatal}}
+		<h1>This application cannot sign you in</h1>
+		<p>{{.Fatal}}</p>
+		{{else}}
+		<h1>{{.Client.Name}} wants to access your MyReference account</h1>
+		<p>It will be able to:</p>
+		<ul>
+			{{range .Scopes}}<li>{{.}}</li>{{end}}
+		</ul>
+		{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+		<form method="POST" action="/v1/oauth/authorize">
+			<input type="hidden" name="client_id" value="{{.Client.ClientID}}">
+			<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+			<input type="hidden" name="response_type" value="code">
+			<input type="hidden" name="scope" value="{{.Scope}}">
+			<input type="hidden" name="state" value="{{.State}}">
+			<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+			<input type="hidden" name="code_challenge_method" value="S256">
+			<p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+			<p><label>Password <input type="password" name="password" required></label></p>
+			<p><label>Two-factor code, if enabled <input type="text" name="code" autocomplete="one-time-code"></label></p>
+			<p>
+				<button type="submit" name="decision" value="approve">Allow</button>
+				<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+			</p>
+		</form>
+		{{end}}
+	</body>
+	</html>
+`))
+
+// The parameters of an authorization request once the client and redirect URI were checked
+type authorizationRequest struct {
+	Client        *data.OAuthClient
+	RedirectURI   string
+	Scope         string
+	Scopes        data.Permissions
+	State         string
+	CodeChallenge string
+	Email         string
+	Error         string
+	Fatal         string
+}
+
+// createOAuthClientHandler() registers a third-party application
+func (app *application) createOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	owner := app.contextGetUser(r)
+	permissions, err := app.models.Permissions.GetAllForUser(owner.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	client := &data.OAuthClient{
+		Name:         input.Name,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       input.Scopes,
+		Confidential: input.Confidential,
+		OwnerID:      owner.ID,
+	}
+
+	v := validator.New()
+	if data.ValidateOAuthClient(v, client, permissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	//The client secret is only returned once
+	err = app.models.OAuth.NewClient(client)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/oauth/clients/%d", client.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"client": client}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listOAuthClientsHandler() returns every registered application
+func (app *application) listOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	clients, err := app.models.OAuth.GetAllClients()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"clients": clients}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteOAuthClientHandler() removes an application and revokes every token issued to it
+func (app *application) deleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.OAuth.DeleteClient(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "client successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// oauthAuthorizeHandler() shows the consent page for an authorization request
+func (app *application) oauthAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := app.readAuthorizationRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+	app.renderConsent(w, r, http.StatusOK, req)
+}
+
+// oauthConsentHandler() signs the user in from the consent page and sends them back to the client with a code
+func (app *application) oauthConsentHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+	err := r.ParseForm()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	req, ok := app.readAuthorizationRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		app.oauthRedirect(w, r, req.RedirectURI, url.Values{"error": {"access_denied"}, "state": {req.State}})
+		return
+	}
+
+	req.Email = r.PostForm.Get("email")
+	user, ok := app.consentUser(w, r, req)
+	if !ok {
+		return
+	}
+
+	code, err := app.models.OAuth.NewCode(&data.OAuthCode{
+		ClientID:      req.Client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+	}, oauthCodeTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.oauthRedirect(w, r, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// consentUser() checks the credentials entered on the consent page the same way a password login does.
+// On failure the page is shown again with the reason
+func (app *application) consentUser(w http.ResponseWriter, r *http.Request, req *authorizationRequest) (*data.User, bool) {
+	accountKey := data.AccountAttemptKey(req.Email)
+	lockedFor, err := app.loginLockedFor(accountKey, data.IPAttemptKey(app.clientIP(r)))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if lockedFor > 0 {
+		req.Error = "Too many failed sign in attempts, please try again later."
+		app.renderConsent(w, r, http.StatusTooManyRequests, req)
+		return nil, false
+	}
+
+	user, err := app.models.WithContext(r.Context()).Users.GetByEmail(req.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	match := false
+	if user != nil {
+		match, err = user.Password.Matches(r.PostForm.Get("password"))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+	}
+	if !match {
+		err = app.recordLoginFailure(r, req.Email, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+		req.Error = "Invalid email or password."
+		app.renderConsent(w, r, http.StatusUnauthorized, req)
+		return nil, false
+	}
+
+	if !user.Activated {
+		req.Error = "Your account must be activated first."
+		app.renderConsent(w, r, http.StatusForbidden, req)
+		return nil, false
+	}
+
+	mfaRequired, err := app.mfaEnabled(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if mfaRequired {
+		ok, err := app.verifySecondFactor(user.ID, r.PostForm.Get("code"), "")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+		if !ok {
+			err = app.recordLoginFailure(r, req.Email, user)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return nil, false
+			}
+			req.Error = "Invalid two-factor code."
+			app.renderConsent(w, r, http.StatusUnauthorized, req)
+			return nil, false
+		}
+	}
+
+	//The user can only hand over permissions they have themselves
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	for _, scope := range req.Scopes {
+		if !permissions.Include(scope) {
+			req.Error = "Your account does not have every permission the application asks for."
+			app.renderConsent(w, r, http.StatusForbidden, req)
+			return nil, false
+		}
+	}
+
+	err = app.models.LoginAttempts.Reset(accountKey)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// readAuthorizationRequest() checks the parameters of an authorization request.
+// Problems with the client or redirect URI are shown on the page, everything else is sent back to the client
+func (app *application) readAuthorizationRequest(w http.ResponseWriter, r *http.Request, values url.Values) (*authorizationRequest, bool) {
+	req := &authorizationRequest{
+		RedirectURI:   values.Get("redirect_uri"),
+		State:         values.Get("state"),
+		CodeChallenge: values.Get("code_challenge"),
+	}
+
+	client, err := app.models.OAuth.GetClient(values.Get("client_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			req.Fatal = "The application is not registered."
+			app.renderConsent(w, r, http.StatusBadRequest, req)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	req.Client = client
+
+	//Never redirect to an address the client did not register
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		req.Fatal = "The redirect URI is not registered for this application."
+		app.renderConsent(w, r, http.StatusBadRequest, req)
+		return nil, false
+	}
+
+	fail := func(code, description string) (*authorizationRequest, bool) {
+		app.oauthRedirect(w, r, req.RedirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {req.State},
+		})
+		return nil, false
+	}
+
+	if values.Get("response_type") != "code" {
+		return fail("unsupported_response_type", "only the code response type is supported")
+	}
+	if req.CodeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		return fail("invalid_request", "PKCE with the S256 method is required")
+	}
+
+	scopes, ok := readScopes(values.Get("scope"), client.Scopes)
+	if !ok {
+		return fail("invalid_scope", "the application may not request these scopes")
+	}
+	req.Scopes = scopes
+	req.Scope = strings.Join(scopes, " ")
+	return req, true
+}
+
+// oauthTokenHandler() is the token endpoint for the authorization code and client credentials grants
+func (app *application) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	client, ok := app.readOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	var userID int64
+	var scopes data.Permissions
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, err := app.models.OAuth.TakeCode(r.PostForm.Get("code"))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "the code is invalid or expired")
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if code.ClientID != client.ID || code.RedirectURI != r.PostForm.Get("redirect_uri") ||
+			oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != code.CodeChallenge {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "the code was not issued for this request")
+			return
+		}
+		userID, scopes = code.UserID, code.Scopes
+	case "client_credentials":
+		//A client acting for itself uses its owner's account, limited to the requested scopes
+		if !client.Confidential {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "unauthorized_client", "public clients cannot use the client credentials grant")
+			return
+		}
+		var ok bool
+		scopes, ok = readScopes(r.PostForm.Get("scope"), client.Scopes)
+		if !ok {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_scope", "the client may not request these scopes")
+			return
+		}
+		userID = client.OwnerID
+	default:
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "unsupported_grant_type", "only the authorization_code and client_credentials grants are supported")
+		return
+	}
+
+	token, err := app.models.OAuth.NewToken(client.ID, userID, scopes, oauthTokenTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"access_token": token.Plaintext,
+		"token_type":   "Bearer",
+		"expires_in":   int(oauthTokenTTL.Seconds()),
+		"scope":        strings.Join(token.Scopes, " "),
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// oauthIntrospectHandler() tells a client whether one of its access tokens is still active
+func (app *application) oauthIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.readOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	token, user, err := app.models.OAuth.GetForToken(r.PostForm.Get("token"))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	//Tokens of other clients are reported as inactive
+	if token == nil || token.ClientID != client.ID {
+		err = app.writeJSON(w, http.StatusOK, envelope{"active": false}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"active":     true,
+		"scope":      strings.Join(token.Scopes, " "),
+		"client_id":  client.ClientID,
+		"username":   user.Email,
+		"sub":        strconv.FormatInt(user.ID, 10),
+		"token_type": "Bearer",
+		"iat":        token.CreatedAt.Unix(),
+		"exp":        token.Expiry.Unix(),
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// oauthRevokeHandler() revokes one of the client's access tokens. Unknown tokens are not an error
+func (app *application) oauthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.readOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.OAuth.RevokeToken(r.PostForm.Get("token"), client.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "token revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOAuthClient() parses the form and authenticates the client with HTTP basic auth or form parameters
+func (app *application) readOAuthClient(w http.ResponseWriter, r *http.Request) (*data.OAuthClient, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+	err := r.ParseForm()
+	if err != nil {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "the request body could not be parsed")
+		return nil, false
+	}
+
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := app.models.OAuth.AuthenticateClient(clientID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+			app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return client, true
+}
+
+// readScopes() parses a space separated scope parameter, an empty one means every scope the client may use
+func readScopes(scope string, allowed data.Permissions) (data.Permissions, bool) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, true
+	}
+	for _, code := range requested {
+		if !allowed.Include(code) {
+			return nil, false
+		}
+	}
+	return requested, true
+}
+
+// oauthRedirect() sends the browser back to the client with the parameters added to the redirect URI
+func (app *application) oauthRedirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	query := u.Query()
+	for key, values := range params {
+		if values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// renderConsent() writes the consent page
+func (app *application) renderConsent(w http.ResponseWriter, r *http.Request, status int, req *authorizationRequest) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	//the page must not be framed by another site to trick users into consenting
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	err := consentPage.Execute(w, req)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
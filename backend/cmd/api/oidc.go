@@ -0,0 +1,203 @@
+// Filename: MyReference/backend/cmd/api/oidc.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"mgomez.net/internal/data"
+	"mgomez.net/internal/oidc"
+)
+
+// How long a user has to sign in at the identity provider
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	errUnverifiedEmail = errors.New("identity provider email address is not verified")
+	errInactiveAccount = errors.New("account with the identity provider email address is not activated")
+)
+
+// oidcLoginHandler() sends the user to the identity provider with a fresh state, nonce and PKCE challenge
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.OIDCStates.Insert(state, &data.OIDCState{
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Expiry:       time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, app.oidc.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// oidcCallbackHandler() finishes the login when the identity provider sends the user back with a code
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	if providerError := qs.Get("error"); providerError != "" {
+		app.logger.PrintInfo("identity provider refused the login", map[string]string{
+			"error":       providerError,
+			"description": qs.Get("error_description"),
+		})
+		app.oidcLoginFailedResponse(w, r)
+		return
+	}
+
+	state, code := qs.Get("state"), qs.Get("code")
+	if state == "" || code == "" {
+		app.badRequestResponse(w, r, errors.New("state and code must be provided"))
+		return
+	}
+
+	//Each state can only be used once, which also stops the nonce from being replayed
+	loginState, err := app.models.OIDCStates.Take(state)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.oidcLoginFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	rawIDToken, err := app.oidc.Exchange(r.Context(), code, loginState.CodeVerifier)
+	if err != nil {
+		app.logError(r, err)
+		app.oidcLoginFailedResponse(w, r)
+		return
+	}
+
+	claims, err := app.oidc.VerifyIDToken(r.Context(), rawIDToken, loginState.Nonce)
+	if err != nil {
+		app.logError(r, err)
+		app.oidcLoginFailedResponse(w, r)
+		return
+	}
+
+	user, err := app.userForIdentity(claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnverifiedEmail):
+			app.oidcUnverifiedEmailResponse(w, r)
+		case errors.Is(err, errInactiveAccount):
+			app.logError(r, err)
+			app.oidcLoginFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.issueLoginTokens(w, r, user)
+}
+
+// userForIdentity() finds the user linked to the external identity. Identities seen for the first time are
+// linked to the activated account with the same verified email address, or a new activated account without a usable password
+func (app *application) userForIdentity(claims *oidc.Claims) (*data.User, error) {
+	user, err := app.models.Identities.GetUser(claims.Issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	//Linking by email is only safe when the provider vouches for the address
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+
+	user, err = app.models.Users.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		//An inactive account may have been deactivated by an administrator, the provider can't switch it back on
+		if !user.Activated {
+			return nil, errInactiveAccount
+		}
+	case errors.Is(err, data.ErrRecordNotFound):
+		user, err = app.createIdentityUser(claims)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = app.models.Identities.Insert(&data.Identity{
+		UserID:  user.ID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	})
+	if err != nil {
+		switch {
+		//a concurrent callback linked the identity first
+		case errors.Is(err, data.ErrDuplicateIdentity):
+			return app.models.Identities.GetUser(claims.Issuer, claims.Subject)
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// createIdentityUser() registers a user who signed in through the identity provider
+func (app *application) createIdentityUser(claims *oidc.Claims) (*data.User, error) {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = claims.Email
+		if at := strings.LastIndex(name, "@"); at > 0 {
+			name = name[:at]
+		}
+	}
+	if len(name) > 500 {
+		name = name[:500]
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+	//Users from the identity provider have no local password until they reset one
+	err := user.Password.Invalidate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Users.Insert(user, app.defaultRoles()...)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -26,8 +26,10 @@ func (app *application) createdReferenceHandler(w http.ResponseWriter, r *http.R
 
 	//copying the information over from the json request
 	reference := &data.Reference{
-		Name:     input.Name,
-		Location: input.Location,
+		Name:        input.Name,
+		Location:    input.Location,
+		UserID:      app.contextGetUser(r).ID,
+		WorkspaceID: app.contextGetWorkspace(r),
 	}
 
 	//creating the validator
@@ -38,9 +40,16 @@ func (app *application) createdReferenceHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	//saving the reference
+	err = app.models.WithContext(r.Context()).Reference.Insert(reference)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	//Creating a location header for the new created resource / Reference
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/references/%d", reference.ID))
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d/references/%d", reference.WorkspaceID, reference.ID))
 
 	//writing the response
 	err = app.writeJSON(w, http.StatusCreated, envelope{"reference": reference}, headers)
@@ -58,7 +67,7 @@ func (app *application) showReferenceHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	reference, err := app.models.Reference.Get(id)
+	reference, err := app.models.WithContext(r.Context()).Reference.Get(id, app.contextGetWorkspace(r))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -69,6 +78,11 @@ func (app *application) showReferenceHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	//the policy decides per record too
+	if !app.authorize(w, r, "reference:read", referenceResource(reference)) {
+		return
+	}
+
 	//writing the json response
 	err = app.writeJSON(w, http.StatusOK, envelope{"reference": reference}, nil)
 	if err != nil {
@@ -86,7 +100,7 @@ func (app *application) updateReferenceHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	//trying to retrieve the reference from the database
-	reference, err := app.models.Reference.Get(id)
+	reference, err := app.models.WithContext(r.Context()).Reference.Get(id, app.contextGetWorkspace(r))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -97,6 +111,11 @@ func (app *application) updateReferenceHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	//checking the stored record against the policy before changing it
+	if !app.authorize(w, r, "reference:write", referenceResource(reference)) {
+		return
+	}
+
 	//constructing a new version of the reference
 	var input struct {
 		Name *string `json:"name"`
@@ -122,7 +141,7 @@ func (app *application) updateReferenceHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	//updating the reference on the database
-	err = app.models.Reference.Update(reference)
+	err = app.models.WithContext(r.Context()).Reference.Update(reference)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -149,8 +168,23 @@ func (app *application) deleteReferenceHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	//fetching the reference first so the policy can look at it
+	reference, err := app.models.WithContext(r.Context()).Reference.Get(id, app.contextGetWorkspace(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !app.authorize(w, r, "reference:delete", referenceResource(reference)) {
+		return
+	}
+
 	//attemping to delete the reference if the id exist on the database
-	err = app.models.Reference.Delete(id)
+	err = app.models.WithContext(r.Context()).Reference.Delete(id, app.contextGetWorkspace(r))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -0,0 +1,122 @@
+// Filename: MyReference/backend/cmd/api/reload.go
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"mgomez.net/internal/jsonlog.go"
+	"mgomez.net/internal/mailer"
+)
+
+// liveConfig holds the configuration in effect. It is replaced as a whole on SIGHUP, so a request
+// sees either the old settings or the new ones, never a mix
+type liveConfig struct {
+	config   config
+	settings []setting
+	mailer   mailer.Mailer
+}
+
+// reloadableSettings can change without a restart, applyReloadable() copies the matching fields
+var reloadableSettings = map[string]bool{
+	"log-level":              true,
+	"limiter-enabled":        true,
+	"limiter-rps":            true,
+	"limiter-burst":          true,
+	"limiter-login-rps":      true,
+	"limiter-login-burst":    true,
+	"limiter-ip-rps":         true,
+	"limiter-ip-burst":       true,
+	"cors-trusted-origins":   true,
+	"cors-allow-credentials": true,
+	"cors-max-age":           true,
+	"smtp-host":              true,
+	"smtp-port":              true,
+	"smtp-username":          true,
+	"smtp-password":          true,
+	"smtp-sender":            true,
+}
+
+// applyReloadable() takes the reloadable settings from next, leaving the rest as they were
+func (cfg *config) applyReloadable(next config) {
+	cfg.logLevel = next.logLevel
+	cfg.limiter.enabled = next.limiter.enabled
+	cfg.limiter.rps = next.limiter.rps
+	cfg.limiter.burst = next.limiter.burst
+	cfg.limiter.loginRPS = next.limiter.loginRPS
+	cfg.limiter.loginBurst = next.limiter.loginBurst
+	cfg.limiter.ipRPS = next.limiter.ipRPS
+	cfg.limiter.ipBurst = next.limiter.ipBurst
+	cfg.cors = next.cors
+	cfg.smtp = next.smtp
+}
+
+// live() returns the configuration in effect, read it once per request and keep the result
+func (app *application) live() *liveConfig {
+	return app.liveConfig.Load().(*liveConfig)
+}
+
+// setLive() puts the configuration into effect, along with a mailer for its SMTP settings
+func (app *application) setLive(cfg config, settings []setting) {
+	app.liveConfig.Store(&liveConfig{
+		config:   cfg,
+		settings: settings,
+		mailer:   mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+	})
+}
+
+// reload() reads the configuration again and applies what can change while serving. Settings
+// that need a restart are reported and left alone, an invalid configuration changes nothing
+func (app *application) reload() {
+	app.reloadMu.Lock()
+	defer app.reloadMu.Unlock()
+
+	next, settings, _, err := loadConfig(os.Args[1:])
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"reload": "kept the running configuration"})
+		return
+	}
+
+	current := app.live()
+	before := make(map[string]setting, len(current.settings))
+	for _, s := range current.settings {
+		before[s.name] = s
+	}
+
+	changed := make(map[string]string)
+	var restart []string
+	for i, s := range settings {
+		old := before[s.name]
+		if old.text == s.text {
+			continue
+		}
+		if !reloadableSettings[s.name] {
+			//keep describing the value that is still in effect
+			restart = append(restart, s.name)
+			settings[i] = old
+			continue
+		}
+		changed[s.name] = old.value + " -> " + s.value
+	}
+
+	cfg := current.config
+	cfg.applyReloadable(next)
+	app.setLive(cfg, settings)
+
+	level, _ := jsonlog.ParseLevel(cfg.logLevel)
+	app.logger.SetLevel(level)
+
+	//notices are written whatever the level, so the change is seen either way
+	if len(changed) == 0 {
+		app.logger.PrintNotice("configuration reloaded, nothing changed", nil)
+	} else {
+		app.logger.PrintNotice("configuration reloaded", changed)
+	}
+	if len(restart) > 0 {
+		sort.Strings(restart)
+		app.logger.PrintNotice("configuration changes need a restart", map[string]string{
+			"settings": strings.Join(restart, " "),
+		})
+	}
+}
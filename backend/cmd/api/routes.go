@@ -5,26 +5,103 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"mgomez.net/internal/data"
 )
 
 func (app *application) routes() http.Handler {
-	router := httprouter.New()
+	router := patternRouter{httprouter.New()}
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 	//default endpoints
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/live", app.livenessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/ready", app.readinessHandler)
+	router.HandlerFunc(http.MethodGet, "/metrics", app.metricsHandler)
 
 	//user related endpoints
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/unlocked", app.unlockUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email/confirmed", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.resetUserPasswordHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenitcatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthenitcatedUser(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireAuthenitcatedUser(app.exportCurrentUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireActivatedUser(app.updateCurrentUserPasswordHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.requireActivatedUser(app.requestEmailChangeHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/mfa", app.createMFAAuthenticationTokenHandler)
 
-	//MyReference related endpoints
+	//single sign-on endpoints
+	router.HandlerFunc(http.MethodGet, "/v1/oidc/login", app.oidcLoginHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/oidc/callback", app.oidcCallbackHandler)
+
+	//OAuth2 authorization server endpoints
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/clients", app.requirePermission("users:admin", app.createOAuthClientHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/clients", app.requirePermission("users:admin", app.listOAuthClientsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/oauth/clients/:id", app.requirePermission("users:admin", app.deleteOAuthClientHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/authorize", app.oauthAuthorizeHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/authorize", app.oauthConsentHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/token", app.oauthTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/introspect", app.oauthIntrospectHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/revoke", app.oauthRevokeHandler)
+
+	//invitation endpoints
+	router.HandlerFunc(http.MethodPost, "/v1/invitations", app.requirePermission("users:invite", app.createInvitationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/invitations", app.requirePermission("users:invite", app.listInvitationsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/invitations/:id", app.requirePermission("users:invite", app.revokeInvitationHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/invitations/accepted", app.acceptInvitationHandler)
+
+	//two-factor authentication endpoints
+	router.HandlerFunc(http.MethodPost, "/v1/users/mfa/totp", app.requireActivatedUser(app.enrolTOTPHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/mfa/totp/enabled", app.requireActivatedUser(app.enableTOTPHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/mfa/totp", app.requireActivatedUser(app.disableTOTPHandler))
+
+	//API key endpoints
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requireActivatedUser(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requireActivatedUser(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requireActivatedUser(app.deleteAPIKeyHandler))
+
+	//admin endpoints
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/activated", app.requirePermission("users:admin", app.updateUserActivationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.requirePermission("users:admin", app.forcePasswordResetHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/tokens", app.requirePermission("users:admin", app.revokeUserTokensHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/impersonation", app.requirePermission("users:admin", app.createImpersonationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.addUserRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", app.requirePermission("users:admin", app.removeUserRoleHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.addUserPermissionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code", app.requirePermission("users:admin", app.removeUserPermissionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/impersonations", app.requirePermission("users:admin", app.listImpersonationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/permissions", app.requirePermission("users:admin", app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/roles", app.requirePermission("users:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/roles", app.requirePermission("users:admin", app.createRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/roles/:code", app.requirePermission("users:admin", app.showRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/lockouts", app.requirePermission("users:admin", app.listLockoutsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/lockouts/:key", app.requirePermission("users:admin", app.deleteLockoutHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/cache", app.requirePermission("users:admin", app.showCacheStatsHandler))
+
+	//workspace endpoints
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces", app.requireActivatedUser(app.createWorkspaceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces", app.requireActivatedUser(app.listWorkspacesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:id", app.requireWorkspaceRole(data.WorkspaceViewer, app.showWorkspaceHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/workspaces/:id", app.requireWorkspaceRole(data.WorkspaceOwner, app.updateWorkspaceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:id", app.requireWorkspaceRole(data.WorkspaceOwner, app.deleteWorkspaceHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces/:id/members", app.requireWorkspaceRole(data.WorkspaceOwner, app.addWorkspaceMemberHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/workspaces/:id/members/:user_id", app.requireWorkspaceRole(data.WorkspaceOwner, app.updateWorkspaceMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:id/members/:user_id", app.requireWorkspaceRole(data.WorkspaceViewer, app.removeWorkspaceMemberHandler))
+
+	//MyReference related endpoints, made inside a workspace
 	router.HandlerFunc(http.MethodPost, "/v1/references", app.requirePermission("reference:write", app.createdReferenceHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/references/:id", app.requirePermission("reference:read", app.showReferenceHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/references/:id", app.requirePermission("reference:write", app.updateReferenceHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/references/:id", app.requirePermission("reference:write", app.deleteReferenceHandler))
 
+	//explains authorization policy decisions to administrators
+	router.HandlerFunc(http.MethodPost, "/v1/authz/check", app.requirePermission("users:admin", app.authzCheckHandler))
+
 	//middleware chain
-	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
+	return app.requestID(app.trace(app.logRequest(app.instrument(app.recoverPanic(app.enableCORS(app.rateLimitIP(app.authenticate(app.rateLimit(app.selectWorkspace(router))))))))))
 }
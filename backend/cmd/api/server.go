@@ -26,6 +26,18 @@ func (app *application) serve() error {
 	//The shudown() function should return its error to this channel
 	shutdownError := make(chan error)
 
+	//Reload the configuration on SIGHUP, without touching the listener or in-flight requests
+	go func() {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		for range hangup {
+			app.logger.PrintInfo("reloading configuration", map[string]string{
+				"signal": syscall.SIGHUP.String(),
+			})
+			app.reload()
+		}
+	}()
+
 	//Start a background Goroutine
 	go func() {
 		//create a quit/exit channel which carries os.Signal values
@@ -38,6 +50,11 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("shutting down server", map[string]string{
 			"signal": s.String(),
 		})
+		//Fail readiness checks and give load balancers time to notice before we stop accepting connections
+		app.setDraining()
+		if app.config.shutdownDelay > 0 {
+			time.Sleep(app.config.shutdownDelay)
+		}
 		//Create a context with a 20-second timeout
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 		defer cancel()
@@ -51,6 +68,11 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 		app.wg.Wait()
+		//Send the spans of the last requests and background tasks
+		err = app.tracer.Shutdown(ctx)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
 		shutdownError <- nil
 	}()
 
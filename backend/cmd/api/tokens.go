@@ -25,17 +25,34 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	//Validate the email and password
 	v := validator.New()
 	data.ValidateEmail(v, input.Email)
-	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidatePasswordInput(v, input.Password)
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	//Refuse to check the password while the account or the IP address is locked out
+	accountKey := data.AccountAttemptKey(input.Email)
+	lockedFor, err := app.loginLockedFor(accountKey, data.IPAttemptKey(app.clientIP(r)))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if lockedFor > 0 {
+		app.loginLockedResponse(w, r, lockedFor)
+		return
+	}
+
 	//Get the user details based on the provided email
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.WithContext(r.Context()).Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.recordLoginFailure(r, input.Email, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 			app.invalidCredntialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -52,12 +69,57 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 
 	//if passwords don't match, then return an invalid credentials response
 	if !match {
+		err = app.recordLoginFailure(r, input.Email, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 		app.invalidCredntialsResponse(w, r)
 		return
 	}
 
-	//Password is correct, so we will generate a authentication token
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	//Upgrade hashes made with an outdated algorithm or cost while we have the plaintext
+	if user.Password.NeedsRehash() {
+		err = app.models.WithContext(r.Context()).Users.UpgradePassword(user, input.Password)
+		if err != nil && !errors.Is(err, data.ErrEditConflict) {
+			app.logError(r, err)
+		}
+	}
+
+	//Forget earlier failures against the account now that the password was right
+	err = app.models.LoginAttempts.Reset(accountKey)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.issueLoginTokens(w, r, user)
+}
+
+// issueLoginTokens() completes a login: users with two-factor authentication get a challenge token,
+// everyone else an authentication token
+func (app *application) issueLoginTokens(w http.ResponseWriter, r *http.Request, user *data.User) {
+	//Users with two-factor authentication get a challenge token instead
+	mfaRequired, err := app.mfaEnabled(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if mfaRequired {
+		challenge, err := app.models.WithContext(r.Context()).Tokens.New(user.ID, mfaChallengeTTL, data.ScopeMFAChallenge)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"mfa_required": true, "challenge_token": challenge}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	//The first factor is correct, so we will generate a authentication token
+	token, err := app.models.WithContext(r.Context()).Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
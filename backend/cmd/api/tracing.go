@@ -0,0 +1,64 @@
+// Filename: MyReference/backend/cmd/api/tracing.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"mgomez.net/internal/jsonlog.go"
+	"mgomez.net/internal/tracing"
+)
+
+// newTracer() returns the tracer selected by the tracing flags, nil when tracing is off
+func newTracer(cfg config, logger *jsonlog.Logger) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch cfg.tracing.exporter {
+	case "none":
+		return nil, nil
+	case "stdout":
+		exporter = tracing.NewStdoutExporter(os.Stdout)
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(cfg.tracing.endpoint, "myreference-api")
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.tracing.exporter)
+	}
+
+	onError := func(err error) {
+		logger.PrintError(err, map[string]string{"tracing": cfg.tracing.exporter})
+	}
+	return tracing.New("myreference-api", exporter, cfg.tracing.ratio, onError), nil
+}
+
+// trace() starts a server span for every request, continuing the caller's trace when it sent a
+// traceparent header. The span is named after the route once the request has been routed
+func (app *application) trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.tracer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		parent, _ := tracing.Extract(r.Header)
+		ctx, span := app.tracer.Start(r.Context(), r.Method, tracing.KindServer, parent)
+		defer span.Finish()
+		r = r.WithContext(ctx)
+		rw := newResponseRecorder(w)
+
+		next.ServeHTTP(rw, r)
+
+		route := app.routeLabel(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.status_code", strconv.Itoa(rw.status))
+		span.SetAttribute("request_id", app.contextGetRequestID(r))
+		if info := app.contextGetRequestInfo(r); info != nil && info.userID != 0 {
+			span.SetAttribute("user_id", strconv.FormatInt(info.userID, 10))
+		}
+		if rw.status >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("responded %d %s", rw.status, http.StatusText(rw.status)))
+		}
+	})
+}
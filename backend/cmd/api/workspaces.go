@@ -0,0 +1,332 @@
+// Filename: MyReference/backend/cmd/api/workspaces.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"mgomez.net/internal/data"
+	"mgomez.net/internal/validator"
+)
+
+// createWorkspaceHandler() creates a workspace with the user as its owner
+func (app *application) createWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if app.delegatedRequest(r) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	workspace := &data.Workspace{
+		Name: input.Name,
+	}
+
+	v := validator.New()
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Workspaces.Insert(workspace, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d", workspace.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"workspace": workspace}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWorkspacesHandler() returns the workspaces the user is a member of
+func (app *application) listWorkspacesHandler(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := app.models.Workspaces.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspaces": workspaces}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWorkspaceHandler() returns a workspace together with its members
+func (app *application) showWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.readWorkspaceParam(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := app.models.Workspaces.GetMembers(workspace.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace, "members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWorkspaceHandler() renames a workspace
+func (app *application) updateWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.readWorkspaceParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		workspace.Name = *input.Name
+	}
+
+	v := validator.New()
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Workspaces.Update(workspace)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWorkspaceHandler() deletes a workspace and every reference in it
+func (app *application) deleteWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Workspaces.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "workspace successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addWorkspaceMemberHandler() adds an existing user to the workspace by email address
+func (app *application) addWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidateWorkspaceRole(v, input.Role)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.WithContext(r.Context()).Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.setWorkspaceMember(w, r, id, user.ID, input.Role)
+}
+
+// updateWorkspaceMemberHandler() changes the role of a member
+func (app *application) updateWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Role string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateWorkspaceRole(v, input.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	userID, err := app.readMemberParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	//Only existing members can have their role changed, new members are added by email
+	_, err = app.models.Workspaces.GetRole(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.setWorkspaceMember(w, r, id, userID, input.Role)
+}
+
+// removeWorkspaceMemberHandler() removes a member. Owners can remove anyone, other members can only leave
+func (app *application) removeWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.readWorkspaceParam(w, r)
+	if !ok {
+		return
+	}
+	userID, err := app.readMemberParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if userID != app.contextGetUser(r).ID && workspace.Role != data.WorkspaceOwner {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Workspaces.RemoveMember(workspace.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastOwner):
+			app.lastWorkspaceOwnerResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setWorkspaceMember() stores the membership and responds with the updated member list
+func (app *application) setWorkspaceMember(w http.ResponseWriter, r *http.Request, workspaceID, userID int64, role string) {
+	err := app.models.Workspaces.SetMember(workspaceID, userID, role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLastOwner):
+			app.lastWorkspaceOwnerResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	members, err := app.models.Workspaces.GetMembers(workspaceID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readWorkspaceParam() loads the workspace named by the :id parameter as seen by the user,
+// writing the error response if it cannot
+func (app *application) readWorkspaceParam(w http.ResponseWriter, r *http.Request) (*data.Workspace, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	workspace, err := app.models.Workspaces.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return workspace, true
+}
+
+// readMemberParam() reads the :user_id parameter
+func (app *application) readMemberParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.ParseInt(params.ByName("user_id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid user_id parameter")
+	}
+	return id, nil
+}
@@ -0,0 +1,64 @@
+// Filename: MyReference/backend/cmd/demo/cors/preflight/main.go
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+)
+
+// Serves a page that signs in from another origin. The JSON body makes it a non-simple request,
+// so the browser sends a preflight OPTIONS request first. Start the API trusting this origin:
+//
+//	go run ./cmd/api -cors-trusted-origins="http://localhost:9000"
+//	go run ./cmd/demo/cors/preflight
+const html = `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+	</head>
+	<body>
+		<h1>
+			Preflight CORS
+		</h1>
+		<div id="output"></div>
+		<script>
+			document.addEventListener('DOMContentLoaded', function(){
+				fetch("http://localhost:4000/v1/tokens/authentication", {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/json"
+					},
+					body: JSON.stringify({
+						email: "alice@example.com",
+						password: "pa55word"
+					})
+				}).then(
+					function(response){
+						response.text().then(function(text){
+							document.getElementById("output").innerHTML=text;
+						});
+					},
+					function(err){
+						document.getElementById("output").innerHTML=err;
+					}
+				);
+			});
+		</script>
+
+	</body>
+	</html>
+`
+
+func main() {
+	addr := flag.String("addr", ":9000", "Server address")
+	flag.Parse()
+
+	log.Printf("starting server on %s", *addr)
+
+	err := http.ListenAndServe(*addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(html))
+	}))
+	log.Fatal(err)
+}
@@ -0,0 +1,37 @@
+// Filename: MyReference/backend/cmd/demo/oidc/main.go
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"mgomez.net/internal/oidc/oidctest"
+)
+
+// A mock OpenID Connect identity provider for trying out single sign-on locally.
+// Anyone can sign in as any email address, so never point a real deployment at it.
+//
+// Start it and the API with:
+//
+//	go run ./cmd/demo/oidc
+//	go run ./cmd/api -oidc-issuer=http://localhost:9096 -oidc-client-id=myreference -oidc-client-secret=secret
+//
+// then open http://localhost:4000/v1/oidc/login in a browser.
+
+func main() {
+	addr := flag.String("addr", ":9096", "Server address")
+	issuer := flag.String("issuer", "http://localhost:9096", "Issuer URL, must match the address the API uses")
+	clientID := flag.String("client-id", "myreference", "Client id of the API")
+	secret := flag.String("client-secret", "secret", "Client secret of the API")
+	redirectURI := flag.String("redirect-uri", "http://localhost:4000/v1/oidc/callback", "Redirect URI of the API")
+	flag.Parse()
+
+	provider, err := oidctest.NewProvider(*issuer, *clientID, *secret, *redirectURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("starting mock identity provider %s on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
@@ -0,0 +1,35 @@
+// Filename: MyReference/backend/cmd/demo/redis/main.go
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"mgomez.net/internal/redistest"
+)
+
+// A stand-in for Redis that understands the few commands the rate limiter sends, for trying
+// out the shared limiter without installing Redis. Everything is kept in memory.
+//
+// Start it and two API replicas with:
+//
+//	go run ./cmd/demo/redis
+//	go run ./cmd/api -port=4000 -limiter-backend=redis -limiter-redis-addr=localhost:6379
+//	go run ./cmd/api -port=4001 -limiter-backend=redis -limiter-redis-addr=localhost:6379
+//
+// and both replicas spend from the same budget.
+
+func main() {
+	addr := flag.String("addr", ":6379", "Server address")
+	password := flag.String("password", "", "Password clients must send with AUTH (empty for none)")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("starting redis stand-in on %s", *addr)
+
+	log.Fatal(redistest.NewServer(*password).Serve(listener))
+}
@@ -0,0 +1,230 @@
+// Filename: MyReference/backend/internal/authz/authz.go
+package authz
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Effect is what a matching rule decides
+type Effect int
+
+const (
+	Allow Effect = iota
+	Deny
+)
+
+func (e Effect) String() string {
+	if e == Deny {
+		return "deny"
+	}
+	return "allow"
+}
+
+// Subject is who is asking
+type Subject struct {
+	UserID        int64    `json:"user_id"`
+	Anonymous     bool     `json:"anonymous"`
+	Activated     bool     `json:"activated"`
+	Permissions   []string `json:"permissions"`
+	WorkspaceID   int64    `json:"workspace_id,omitempty"`
+	WorkspaceRole string   `json:"workspace_role,omitempty"`
+}
+
+// Has() reports whether the subject holds the permission code
+func (s Subject) Has(code string) bool {
+	for _, permission := range s.Permissions {
+		if permission == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Resource is the record being acted on. Requests that are checked before a record is loaded have none
+type Resource struct {
+	Type        string                 `json:"type"`
+	ID          int64                  `json:"id"`
+	OwnerID     int64                  `json:"owner_id"`
+	WorkspaceID int64                  `json:"workspace_id"`
+	Fields      map[string]interface{} `json:"fields"`
+}
+
+// Input is everything a rule can look at
+type Input struct {
+	Subject  Subject
+	Action   string
+	Resource *Resource
+}
+
+// A Condition inspects the input, a rule only applies when its condition holds
+type Condition func(in Input) bool
+
+// Rule allows or denies actions, optionally only on one type of resource
+type Rule struct {
+	Name         string
+	Description  string
+	Effect       Effect
+	Actions      []string
+	ResourceType string
+	When         Condition
+}
+
+// matches() reports whether the rule applies to the input
+func (rule Rule) matches(in Input) bool {
+	matched := false
+	for _, action := range rule.Actions {
+		if action == "*" || action == in.Action {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	//Rules for a resource type only apply once the record is known
+	if rule.ResourceType != "" && (in.Resource == nil || in.Resource.Type != rule.ResourceType) {
+		return false
+	}
+	return rule.When == nil || rule.When(in)
+}
+
+// Decision is the outcome of evaluating a policy, naming the rule that decided it
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// Policy is an ordered set of rules. Any matching deny rule wins, otherwise a matching
+// allow rule is needed, and when nothing matches the action is denied
+type Policy struct {
+	rules []Rule
+}
+
+// New() creates a policy from the rules
+func New(rules ...Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// Rules() returns the rules of the policy in order
+func (p *Policy) Rules() []Rule {
+	return p.rules
+}
+
+// Evaluate() decides whether the subject may perform the action
+func (p *Policy) Evaluate(in Input) Decision {
+	var allowedBy *Rule
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if !rule.matches(in) {
+			continue
+		}
+		if rule.Effect == Deny {
+			return Decision{Allowed: false, Rule: rule.Name, Reason: rule.Description}
+		}
+		if allowedBy == nil {
+			allowedBy = rule
+		}
+	}
+	if allowedBy != nil {
+		return Decision{Allowed: true, Rule: allowedBy.Name, Reason: allowedBy.Description}
+	}
+	return Decision{Allowed: false, Reason: fmt.Sprintf("no rule allows %q", in.Action)}
+}
+
+// HasPermission() holds when the subject has the permission code
+func HasPermission(code string) Condition {
+	return func(in Input) bool {
+		return in.Subject.Has(code)
+	}
+}
+
+// ActionIsPermission() holds when the subject has a permission with the same code as the action
+func ActionIsPermission() Condition {
+	return func(in Input) bool {
+		return in.Subject.Has(in.Action)
+	}
+}
+
+// Activated() holds for signed in users with an activated account
+func Activated() Condition {
+	return func(in Input) bool {
+		return !in.Subject.Anonymous && in.Subject.Activated
+	}
+}
+
+// IsOwner() holds when the subject created the resource
+func IsOwner() Condition {
+	return func(in Input) bool {
+		return in.Resource != nil && in.Resource.OwnerID != 0 && in.Resource.OwnerID == in.Subject.UserID
+	}
+}
+
+// WorkspaceRole() holds when the subject has one of the roles in the resource's workspace
+func WorkspaceRole(roles ...string) Condition {
+	return func(in Input) bool {
+		if in.Resource != nil && in.Resource.WorkspaceID != in.Subject.WorkspaceID {
+			return false
+		}
+		for _, role := range roles {
+			if in.Subject.WorkspaceRole == role {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FieldEquals() holds when the resource field has the value
+func FieldEquals(field string, value interface{}) Condition {
+	return func(in Input) bool {
+		if in.Resource == nil {
+			return false
+		}
+		v, ok := in.Resource.Fields[field]
+		return ok && v == value
+	}
+}
+
+// FieldHasPrefix() holds when the resource field is a string starting with the prefix
+func FieldHasPrefix(field, prefix string) Condition {
+	return func(in Input) bool {
+		if in.Resource == nil {
+			return false
+		}
+		v, ok := in.Resource.Fields[field].(string)
+		return ok && strings.HasPrefix(v, prefix)
+	}
+}
+
+// All() holds when every condition holds
+func All(conditions ...Condition) Condition {
+	return func(in Input) bool {
+		for _, condition := range conditions {
+			if !condition(in) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any() holds when at least one condition holds
+func Any(conditions ...Condition) Condition {
+	return func(in Input) bool {
+		for _, condition := range conditions {
+			if condition(in) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not() holds when the condition does not
+func Not(condition Condition) Condition {
+	return func(in Input) bool {
+		return !condition(in)
+	}
+}
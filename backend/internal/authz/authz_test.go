@@ -0,0 +1,68 @@
+// Filename: MyReference/backend/internal/authz/authz_test.go
+package authz
+
+import "testing"
+
+func TestEvaluate(t *testing.T) {
+	policy := New(
+		Rule{
+			Name:    "everyone-reads",
+			Effect:  Allow,
+			Actions: []string{"read"},
+		},
+		Rule{
+			Name:    "no-guests",
+			Effect:  Deny,
+			Actions: []string{"*"},
+			When: func(in Input) bool {
+				return in.Subject.Anonymous
+			},
+		},
+		Rule{
+			Name:         "owners-delete-notes",
+			Effect:       Allow,
+			Actions:      []string{"delete"},
+			ResourceType: "note",
+			When:         IsOwner(),
+		},
+		Rule{
+			Name:    "granted-permission",
+			Effect:  Allow,
+			Actions: []string{"*"},
+			When:    ActionIsPermission(),
+		},
+	)
+
+	user := Subject{UserID: 1, Activated: true, Permissions: []string{"write"}}
+	guest := Subject{Anonymous: true, Permissions: []string{"write"}}
+	note := &Resource{Type: "note", ID: 7, OwnerID: 1}
+	task := &Resource{Type: "task", ID: 8, OwnerID: 1}
+
+	tests := []struct {
+		name    string
+		in      Input
+		allowed bool
+		rule    string
+	}{
+		{"allow rule matches", Input{Subject: user, Action: "read"}, true, "everyone-reads"},
+		{"deny wins over an earlier allow", Input{Subject: guest, Action: "read"}, false, "no-guests"},
+		{"deny wins over a later allow", Input{Subject: guest, Action: "write"}, false, "no-guests"},
+		{"permission named by the action", Input{Subject: user, Action: "write"}, true, "granted-permission"},
+		{"nothing matches", Input{Subject: user, Action: "archive"}, false, ""},
+		{"resource rule applies to its type", Input{Subject: user, Action: "delete", Resource: note}, true, "owners-delete-notes"},
+		{"resource rule skips other types", Input{Subject: user, Action: "delete", Resource: task}, false, ""},
+		{"resource rule needs a resource", Input{Subject: user, Action: "delete"}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := policy.Evaluate(tt.in)
+			if decision.Allowed != tt.allowed {
+				t.Errorf("got allowed %t; want %t", decision.Allowed, tt.allowed)
+			}
+			if decision.Rule != tt.rule {
+				t.Errorf("got rule %q; want %q", decision.Rule, tt.rule)
+			}
+		})
+	}
+}
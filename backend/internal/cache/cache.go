@@ -0,0 +1,109 @@
+// Filename: MyReference/backend/internal/cache/cache.go
+package cache
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// A Store holds encoded values. The in-memory LRU is used by default, a store shared
+// between instances of the API can be plugged in instead
+type Store interface {
+	//Get() returns the value for the key, and false when there is none
+	Get(key string) ([]byte, bool, error)
+	//Set() stores the value for the key until the ttl passes
+	Set(key string, value []byte, ttl time.Duration) error
+	//Delete() removes the keys
+	Delete(keys ...string) error
+}
+
+// Stats counts how the cache has been used
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Errors    uint64 `json:"errors"`
+	Entries   int    `json:"entries,omitempty"`
+	Evictions uint64 `json:"evictions,omitempty"`
+}
+
+// Cache stores values as JSON in a Store and counts hits and misses.
+// A nil *Cache is valid and never holds anything, so callers don't need to check if caching is on
+type Cache struct {
+	store  Store
+	ttl    time.Duration
+	hits   uint64
+	misses uint64
+	errors uint64
+}
+
+// New() creates a cache on top of the store, ttl is the longest an entry is kept
+func New(store Store, ttl time.Duration) *Cache {
+	return &Cache{store: store, ttl: ttl}
+}
+
+// Get() decodes the value for the key into dst and reports whether it was found.
+// Errors from the store count as a miss so the caller falls back to the database
+func (c *Cache) Get(key string, dst interface{}) bool {
+	if c == nil {
+		return false
+	}
+	value, found, err := c.store.Get(key)
+	if err == nil && found {
+		err = json.Unmarshal(value, dst)
+		if err == nil {
+			atomic.AddUint64(&c.hits, 1)
+			return true
+		}
+	}
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+	atomic.AddUint64(&c.misses, 1)
+	return false
+}
+
+// Set() stores the value for the key. The ttl is capped to the cache's ttl, zero means the cache's ttl
+func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
+	if c == nil {
+		return
+	}
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+	encoded, err := json.Marshal(value)
+	if err == nil {
+		err = c.store.Set(key, encoded, ttl)
+	}
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+}
+
+// Delete() removes the keys from the cache
+func (c *Cache) Delete(keys ...string) {
+	if c == nil {
+		return
+	}
+	err := c.store.Delete(keys...)
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+}
+
+// Stats() returns the counters, with the size of the store when it is an LRU
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	stats := Stats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Errors: atomic.LoadUint64(&c.errors),
+	}
+	if lru, ok := c.store.(*LRU); ok {
+		stats.Entries = lru.Len()
+		stats.Evictions = lru.Evictions()
+	}
+	return stats
+}
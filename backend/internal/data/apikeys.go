@@ -0,0 +1,290 @@
+// Filename: MyReference/backend/internal/data/apikeys.go
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"mgomez.net/internal/validator"
+)
+
+// Define the APIKey type
+type APIKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	AllowedIPs  []string    `json:"allowed_ips"`
+	Expiry      *time.Time  `json:"expiry,omitempty"`
+	LastUsedAt  *time.Time  `json:"last_used_at,omitempty"`
+}
+
+// AllowsIP() checks if the key may be used from the supplied address.
+// An empty allowlist means the key can be used from anywhere
+func (k *APIKey) AllowsIP(ip net.IP) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range k.AllowedIPs {
+		if strings.Contains(allowed, "/") {
+			_, network, err := net.ParseCIDR(allowed)
+			if err == nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// The generateAPIKey function returns a new key with its plaintext and hash filled in
+func generateAPIKey(userID int64, name string, permissions Permissions, allowedIPs []string, expiry *time.Time) (*APIKey, error) {
+	key := &APIKey{
+		UserID:      userID,
+		Name:        name,
+		Permissions: permissions,
+		AllowedIPs:  allowedIPs,
+		Expiry:      expiry,
+	}
+	if key.AllowedIPs == nil {
+		key.AllowedIPs = []string{}
+	}
+
+	//API keys are longer lived than tokens so we use 32 bytes of randomness
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	return key, nil
+}
+
+// check that the plaintext key is 52 bytes long
+func ValidateAPIKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(keyPlaintext != "", "key", "must be provided")
+	v.Check(len(keyPlaintext) == 52, "key", "must be 52 bytes long")
+}
+
+// ValidateAPIKey() validates the input used to create a key
+func ValidateAPIKey(v *validator.Validator, key *APIKey, ownerPermissions Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 characters long")
+
+	//The key may only carry permissions that the owner already has
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain at least one permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range key.Permissions {
+		v.Check(ownerPermissions.Include(code), "permissions", "must only contain permissions you have been granted")
+	}
+
+	v.Check(len(key.AllowedIPs) <= 20, "allowed_ips", "must not contain more than 20 entries")
+	for _, allowed := range key.AllowedIPs {
+		_, _, cidrErr := net.ParseCIDR(allowed)
+		v.Check(cidrErr == nil || net.ParseIP(allowed) != nil, "allowed_ips", "must only contain IP addresses or CIDR ranges")
+	}
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+// Define the APIKey model
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// Create and insert a key into the api_keys table
+func (m APIKeyModel) New(userID int64, name string, permissions Permissions, allowedIPs []string, expiry *time.Time) (*APIKey, error) {
+	key, err := generateAPIKey(userID, name, permissions, allowedIPs, expiry)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Insert(key)
+	return key, err
+}
+
+// Insert will insert a entry into the api_keys table
+func (m APIKeyModel) Insert(key *APIKey) error {
+	query := `
+		insert into api_keys (user_id, name, hash, permissions, allowed_ips, expiry)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id, created_at
+	`
+	args := []interface{}{
+		key.UserID,
+		key.Name,
+		key.Hash,
+		pq.Array([]string(key.Permissions)),
+		pq.Array(key.AllowedIPs),
+		key.Expiry,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAllForUser() returns every key owned by the user; the plaintext is never returned
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+		select id, created_at, user_id, name, permissions, allowed_ips, expiry, last_used_at
+		from api_keys
+		where user_id = $1
+		order by id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			pq.Array((*[]string)(&key.Permissions)),
+			pq.Array(&key.AllowedIPs),
+			&key.Expiry,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetForKey() returns the key and its owner for an unexpired plaintext key
+func (m APIKeyModel) GetForKey(keyPlaintext string) (*APIKey, *User, error) {
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+	query := `
+		select api_keys.id, api_keys.created_at, api_keys.user_id, api_keys.name, api_keys.permissions,
+		api_keys.allowed_ips, api_keys.expiry, api_keys.last_used_at,
+		users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		from api_keys
+		inner join users
+		on users.id = api_keys.user_id
+		where api_keys.hash = $1
+		and (api_keys.expiry is null or api_keys.expiry > $2)
+	`
+	var key APIKey
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, keyHash[:], time.Now()).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		pq.Array((*[]string)(&key.Permissions)),
+		pq.Array(&key.AllowedIPs),
+		&key.Expiry,
+		&key.LastUsedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	return &key, &user, nil
+}
+
+// Touch() records when the key was last used
+func (m APIKeyModel) Touch(id int64) error {
+	query := `
+		update api_keys
+		set last_used_at = now()
+		where id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// Delete() removes a key owned by the user
+func (m APIKeyModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		delete from api_keys
+		where id = $1 and user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllForUser() revokes every key owned by the user
+func (m APIKeyModel) DeleteAllForUser(userID int64) error {
+	query := `
+		delete from api_keys
+		where user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
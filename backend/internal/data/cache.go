@@ -0,0 +1,111 @@
+// Filename: MyReference/backend/internal/data/cache.go
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"mgomez.net/internal/cache"
+)
+
+// cachedUser is what is kept for an authentication token, the password hash
+// is unexported on User so it is copied over explicitly
+type cachedUser struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	PasswordHash []byte    `json:"password_hash"`
+	Activated    bool      `json:"activated"`
+	Version      int       `json:"version"`
+	Generation   string    `json:"generation"`
+}
+
+func tokenCacheKey(tokenHash []byte) string {
+	return "token:" + hex.EncodeToString(tokenHash)
+}
+
+func permissionsCacheKey(userID int64) string {
+	return fmt.Sprintf("permissions:%d", userID)
+}
+
+// userGenerationCacheKey() holds the user's generation, it changes whenever the user is invalidated
+// and a cached token is only used while it matches the generation it was stored under
+func userGenerationCacheKey(userID int64) string {
+	return fmt.Sprintf("user-generation:%d", userID)
+}
+
+// newGeneration() returns a random generation, so changing it never needs to read the old one
+func newGeneration() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// userGeneration() returns the user's current generation, starting a new one when there is none
+func userGeneration(c *cache.Cache, userID int64) string {
+	var generation string
+	if !c.Get(userGenerationCacheKey(userID), &generation) {
+		generation = newGeneration()
+		c.Set(userGenerationCacheKey(userID), generation, 0)
+	}
+	return generation
+}
+
+// cacheUserForToken() remembers the user an authentication token belongs to until the token expires.
+// generation is the user's generation read before the user was, if it has moved on since then the
+// user changed while being read and nothing is cached
+func cacheUserForToken(c *cache.Cache, tokenHash []byte, user *User, expiry time.Time, generation string) {
+	if c == nil {
+		return
+	}
+	var current string
+	if !c.Get(userGenerationCacheKey(user.ID), &current) || current != generation {
+		return
+	}
+	c.Set(tokenCacheKey(tokenHash), cachedUser{
+		ID:           user.ID,
+		CreatedAt:    user.CreatedAt,
+		Name:         user.Name,
+		Email:        user.Email,
+		PasswordHash: user.Password.hash,
+		Activated:    user.Activated,
+		Version:      user.Version,
+		Generation:   generation,
+	}, time.Until(expiry))
+}
+
+// cachedUserForToken() looks up the user for an authentication token in the cache. Entries stored
+// before the user was last invalidated, or whose generation was evicted, count as a miss
+func cachedUserForToken(c *cache.Cache, tokenHash []byte) (*User, bool) {
+	var cached cachedUser
+	if !c.Get(tokenCacheKey(tokenHash), &cached) {
+		return nil, false
+	}
+	var generation string
+	if !c.Get(userGenerationCacheKey(cached.ID), &generation) || generation != cached.Generation {
+		return nil, false
+	}
+	user := &User{
+		ID:        cached.ID,
+		CreatedAt: cached.CreatedAt,
+		Name:      cached.Name,
+		Email:     cached.Email,
+		Activated: cached.Activated,
+		Version:   cached.Version,
+	}
+	user.Password.hash = cached.PasswordHash
+	return user, true
+}
+
+// invalidateUser() drops everything cached about the user, called whenever the user,
+// their tokens or their permissions change. Starting a new generation retires every cached token at once
+func invalidateUser(c *cache.Cache, userID int64) {
+	if c == nil {
+		return
+	}
+	c.Set(userGenerationCacheKey(userID), newGeneration(), 0)
+	c.Delete(permissionsCacheKey(userID))
+}
@@ -0,0 +1,99 @@
+// Filename: MyReference/backend/internal/data/emailchanges.go
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Define the EmailChange type, a pending change to a new address waiting to be confirmed
+type EmailChange struct {
+	Token  *Token
+	UserID int64
+	Email  string
+}
+
+// Define the EmailChange model
+type EmailChangeModel struct {
+	DB *sql.DB
+}
+
+// New() creates a pending change and the token sent to the new address to confirm it.
+// Any earlier pending change for the user is replaced
+func (m EmailChangeModel) New(userID int64, email string, ttl time.Duration) (*EmailChange, error) {
+	token, err := generateToken(userID, ttl, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+	change := &EmailChange{
+		Token:  token,
+		UserID: userID,
+		Email:  email,
+	}
+
+	err = m.DeleteAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		insert into email_changes (hash, user_id, email, expiry)
+		values ($1, $2, $3, $4)
+	`
+	args := []interface{}{
+		token.Hash,
+		userID,
+		email,
+		token.Expiry,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// GetForToken() returns the unexpired change a confirmation token belongs to
+func (m EmailChangeModel) GetForToken(tokenPlaintext string) (*EmailChange, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		select user_id, email
+		from email_changes
+		where hash = $1
+		and expiry > $2
+	`
+	var change EmailChange
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()).Scan(&change.UserID, &change.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &change, nil
+}
+
+// DeleteAllForUser() removes every pending change for the user
+func (m EmailChangeModel) DeleteAllForUser(userID int64) error {
+	query := `
+		delete from email_changes
+		where user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,200 @@
+// Filename: MyReference/backend/internal/data/hashers.go
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+)
+
+// A PasswordHasher creates and checks password hashes for one algorithm
+type PasswordHasher interface {
+	//Hash() returns the encoded hash of the plaintext password
+	Hash(plaintextPassword string) ([]byte, error)
+	//Compare() checks a plaintext password against an encoded hash made by this algorithm
+	Compare(hash []byte, plaintextPassword string) (bool, error)
+	//Recognizes() reports whether the encoded hash was made by this algorithm
+	Recognizes(hash []byte) bool
+	//Outdated() reports whether a hash made by this algorithm uses weaker parameters than the hasher
+	Outdated(hash []byte) bool
+	//MaxLength() is the longest password in bytes the algorithm takes into account
+	MaxLength() int
+}
+
+// The hasher used for new passwords, the other algorithms are only used to check old hashes
+var (
+	hasherMu      sync.RWMutex
+	currentHasher PasswordHasher = BcryptHasher{Cost: 12}
+)
+
+// SetPasswordHasher() changes the algorithm used for new passwords
+func SetPasswordHasher(hasher PasswordHasher) {
+	hasherMu.Lock()
+	defer hasherMu.Unlock()
+	currentHasher = hasher
+}
+
+// passwordHasher() returns the algorithm used for new passwords
+func passwordHasher() PasswordHasher {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	return currentHasher
+}
+
+// hasherFor() finds the algorithm that made an existing hash
+func hasherFor(hash []byte) (PasswordHasher, error) {
+	current := passwordHasher()
+	if current.Recognizes(hash) {
+		return current, nil
+	}
+	for _, hasher := range []PasswordHasher{Argon2idHasher{}, BcryptHasher{}} {
+		if hasher.Recognizes(hash) {
+			return hasher, nil
+		}
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+// BcryptHasher hashes passwords with bcrypt, note that it ignores everything after 72 bytes
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(plaintextPassword string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(plaintextPassword), h.Cost)
+}
+
+func (h BcryptHasher) Compare(hash []byte, plaintextPassword string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(plaintextPassword))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (h BcryptHasher) Recognizes(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) || bytes.HasPrefix(hash, []byte("$2b$")) || bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+func (h BcryptHasher) Outdated(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost < h.Cost
+}
+
+func (h BcryptHasher) MaxLength() int {
+	return 72
+}
+
+// Argon2idHasher hashes passwords with argon2id and encodes them in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// The decoded form of an argon2id hash
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h Argon2idHasher) Hash(plaintextPassword string) ([]byte, error) {
+	salt := make([]byte, h.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintextPassword), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return []byte(encoded), nil
+}
+
+func (h Argon2idHasher) Compare(hash []byte, plaintextPassword string) (bool, error) {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(plaintextPassword), decoded.salt, decoded.iterations, decoded.memory, decoded.parallelism, uint32(len(decoded.key)))
+	return subtle.ConstantTimeCompare(key, decoded.key) == 1, nil
+}
+
+func (h Argon2idHasher) Recognizes(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$argon2id$"))
+}
+
+func (h Argon2idHasher) Outdated(hash []byte) bool {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return decoded.memory < h.Memory ||
+		decoded.iterations < h.Iterations ||
+		decoded.parallelism < h.Parallelism ||
+		uint32(len(decoded.salt)) < h.SaltLength ||
+		uint32(len(decoded.key)) < h.KeyLength
+}
+
+func (h Argon2idHasher) MaxLength() int {
+	//argon2 has no limit of its own, this just stops very large inputs from being hashed
+	return 1024
+}
+
+// decodeArgon2id() parses a PHC formatted argon2id hash
+func decodeArgon2id(hash []byte) (*argon2idHash, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var decoded argon2idHash
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &decoded.memory, &decoded.iterations, &decoded.parallelism)
+	if err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+
+	decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+	decoded.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(decoded.key) == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+	return &decoded, nil
+}
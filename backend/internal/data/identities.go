@@ -0,0 +1,185 @@
+// Filename: MyReference/backend/internal/data/identities.go
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDuplicateIdentity = errors.New("duplicate identity")
+)
+
+// Define the Identity type, an account at an external identity provider linked to a user
+type Identity struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"-"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+}
+
+// Define the Identity model
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// Insert() links the external identity to the user
+func (m IdentityModel) Insert(identity *Identity) error {
+	query := `
+		insert into user_identities (user_id, issuer, subject, email)
+		values ($1, $2, $3, $4)
+		returning id, created_at
+	`
+	args := []interface{}{
+		identity.UserID,
+		identity.Issuer,
+		identity.Subject,
+		identity.Email,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_identities_issuer_subject_key"`:
+			return ErrDuplicateIdentity
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUser() returns the user an external identity is linked to
+func (m IdentityModel) GetUser(issuer, subject string) (*User, error) {
+	query := `
+		select users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		from users
+		inner join user_identities on user_identities.user_id = users.id
+		where user_identities.issuer = $1 and user_identities.subject = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetAllForUser() returns the external identities linked to the user
+func (m IdentityModel) GetAllForUser(userID int64) ([]*Identity, error) {
+	query := `
+		select id, created_at, user_id, issuer, subject, email
+		from user_identities
+		where user_id = $1
+		order by id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+	for rows.Next() {
+		var identity Identity
+		err := rows.Scan(
+			&identity.ID,
+			&identity.CreatedAt,
+			&identity.UserID,
+			&identity.Issuer,
+			&identity.Subject,
+			&identity.Email,
+		)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Define the OIDCState type, what the API remembers between sending the user to the
+// identity provider and the provider sending them back
+type OIDCState struct {
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+// Define the OIDCState model
+type OIDCStateModel struct {
+	DB *sql.DB
+}
+
+// Insert() stores the nonce and PKCE verifier under the hash of the state parameter
+func (m OIDCStateModel) Insert(state string, oidcState *OIDCState) error {
+	stateHash := sha256.Sum256([]byte(state))
+	query := `
+		insert into oidc_states (state_hash, nonce, code_verifier, expiry)
+		values ($1, $2, $3, $4)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, stateHash[:], oidcState.Nonce, oidcState.CodeVerifier, oidcState.Expiry)
+	return err
+}
+
+// Take() returns and removes the unexpired login state, so each state can only be used once.
+// Expired states are cleared out at the same time
+func (m OIDCStateModel) Take(state string) (*OIDCState, error) {
+	stateHash := sha256.Sum256([]byte(state))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from oidc_states where expiry <= $1`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		delete from oidc_states
+		where state_hash = $1
+		returning nonce, code_verifier, expiry
+	`
+	var oidcState OIDCState
+	err = m.DB.QueryRowContext(ctx, query, stateHash[:]).Scan(&oidcState.Nonce, &oidcState.CodeVerifier, &oidcState.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &oidcState, nil
+}
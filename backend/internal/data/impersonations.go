@@ -0,0 +1,164 @@
+// Filename: MyReference/backend/internal/data/impersonations.go
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"mgomez.net/internal/validator"
+)
+
+// ImpersonationTokenPrefix starts every impersonation token, so they are only looked up as such
+const ImpersonationTokenPrefix = "imp_"
+
+// Define the Impersonation type, the audit record of an administrator acting as a user
+type Impersonation struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	AdminID   int64     `json:"admin_id"`
+	UserID    int64     `json:"user_id"`
+	Reason    string    `json:"reason"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// ValidateImpersonation() checks that a reason was given for the audit trail
+func ValidateImpersonation(v *validator.Validator, impersonation *Impersonation) {
+	v.Check(impersonation.Reason != "", "reason", "must be provided")
+	v.Check(len(impersonation.Reason) <= 500, "reason", "must not be more than 500 characters long")
+	v.Check(impersonation.AdminID != impersonation.UserID, "user_id", "must not be your own account")
+}
+
+// Define the Impersonation model
+type ImpersonationModel struct {
+	DB *sql.DB
+}
+
+// New() creates the impersonation token and records who asked for it and why
+func (m ImpersonationModel) New(impersonation *Impersonation, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(impersonation.UserID, ttl, ScopeImpersonation)
+	if err != nil {
+		return nil, err
+	}
+	token.Plaintext = ImpersonationTokenPrefix + token.Plaintext
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		insert into impersonations (admin_id, user_id, reason, token_hash, expiry)
+		values ($1, $2, $3, $4, $5)
+		returning id, created_at
+	`
+	args := []interface{}{
+		impersonation.AdminID,
+		impersonation.UserID,
+		impersonation.Reason,
+		token.Hash,
+		token.Expiry,
+	}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&impersonation.ID, &impersonation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	impersonation.Expiry = token.Expiry
+
+	query = `
+		insert into tokens (hash, user_id, expiry, scope)
+		values ($1, $2, $3, $4)
+	`
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, tx.Commit()
+}
+
+// GetForToken() returns the audit record an impersonation token was issued with
+func (m ImpersonationModel) GetForToken(tokenPlaintext string) (*Impersonation, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		select id, created_at, coalesce(admin_id, 0), user_id, reason, expiry
+		from impersonations
+		where token_hash = $1
+	`
+	var impersonation Impersonation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:]).Scan(
+		&impersonation.ID,
+		&impersonation.CreatedAt,
+		&impersonation.AdminID,
+		&impersonation.UserID,
+		&impersonation.Reason,
+		&impersonation.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &impersonation, nil
+}
+
+// GetAll() returns the audit trail, optionally only for one user
+func (m ImpersonationModel) GetAll(userID int64, filters Filters) ([]*Impersonation, Metadata, error) {
+	query := fmt.Sprintf(`
+		select count(*) over(), id, created_at, coalesce(admin_id, 0), user_id, reason, expiry
+		from impersonations
+		where (user_id = $1 or $1 = 0)
+		order by %s %s, id desc
+		limit $2 offset $3
+	`, filters.sortColumn(), filters.sortOrder())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	impersonations := []*Impersonation{}
+	for rows.Next() {
+		var impersonation Impersonation
+		err := rows.Scan(
+			&totalRecords,
+			&impersonation.ID,
+			&impersonation.CreatedAt,
+			&impersonation.AdminID,
+			&impersonation.UserID,
+			&impersonation.Reason,
+			&impersonation.Expiry,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		impersonations = append(impersonations, &impersonation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return impersonations, metadata, nil
+}
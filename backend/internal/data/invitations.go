@@ -0,0 +1,237 @@
+// Filename: MyReference/backend/internal/data/invitations.go
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"mgomez.net/internal/validator"
+)
+
+// Define the Invitation type, an emailed offer to join the service and optionally a workspace
+type Invitation struct {
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Email         string     `json:"email"`
+	InvitedBy     int64      `json:"invited_by,omitempty"`
+	WorkspaceID   int64      `json:"workspace_id,omitempty"`
+	WorkspaceRole string     `json:"workspace_role,omitempty"`
+	Expiry        time.Time  `json:"expiry"`
+	AcceptedAt    *time.Time `json:"accepted_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+}
+
+// ValidateInvitation() validates the invitation input
+func ValidateInvitation(v *validator.Validator, invitation *Invitation) {
+	ValidateEmail(v, invitation.Email)
+	if invitation.WorkspaceID != 0 || invitation.WorkspaceRole != "" {
+		v.Check(invitation.WorkspaceID > 0, "workspace_id", "must be provided together with a workspace role")
+		ValidateWorkspaceRole(v, invitation.WorkspaceRole)
+	}
+}
+
+// Define the Invitation model
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+// New() stores the invitation and returns the token to email to the invitee
+func (m InvitationModel) New(invitation *Invitation, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(invitation.InvitedBy, ttl, ScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		insert into invitations (email, invited_by, workspace_id, workspace_role, token_hash, expiry)
+		values ($1, $2, nullif($3, 0), nullif($4, ''), $5, $6)
+		returning id, created_at, expiry
+	`
+	args := []interface{}{
+		invitation.Email,
+		invitation.InvitedBy,
+		invitation.WorkspaceID,
+		invitation.WorkspaceRole,
+		token.Hash,
+		token.Expiry,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt, &invitation.Expiry)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetForToken() returns the pending invitation a token belongs to.
+// Accepted, revoked and expired invitations are not found
+func (m InvitationModel) GetForToken(tokenPlaintext string) (*Invitation, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		select id, created_at, email, coalesce(invited_by, 0), coalesce(workspace_id, 0), coalesce(workspace_role, ''), expiry, accepted_at, revoked_at
+		from invitations
+		where token_hash = $1
+		and expiry > $2
+		and accepted_at is null
+		and revoked_at is null
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var invitation Invitation
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()).Scan(
+		&invitation.ID,
+		&invitation.CreatedAt,
+		&invitation.Email,
+		&invitation.InvitedBy,
+		&invitation.WorkspaceID,
+		&invitation.WorkspaceRole,
+		&invitation.Expiry,
+		&invitation.AcceptedAt,
+		&invitation.RevokedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &invitation, nil
+}
+
+// GetAllPending() returns the invitations that can still be accepted, newest first
+func (m InvitationModel) GetAllPending() ([]*Invitation, error) {
+	query := `
+		select id, created_at, email, coalesce(invited_by, 0), coalesce(workspace_id, 0), coalesce(workspace_role, ''), expiry, accepted_at, revoked_at
+		from invitations
+		where expiry > $1
+		and accepted_at is null
+		and revoked_at is null
+		order by created_at desc, id desc
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		err := rows.Scan(
+			&invitation.ID,
+			&invitation.CreatedAt,
+			&invitation.Email,
+			&invitation.InvitedBy,
+			&invitation.WorkspaceID,
+			&invitation.WorkspaceRole,
+			&invitation.Expiry,
+			&invitation.AcceptedAt,
+			&invitation.RevokedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &invitation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// Accept() marks a pending invitation as used and, in the same transaction, inserts the user with the
+// roles when they have no account yet and adds them to the invitation's workspace. If the invitation
+// was accepted or revoked in the meantime ErrEditConflict is returned so it can never be used twice,
+// and nothing is changed when a step fails so the invitation can be accepted again
+func (m InvitationModel) Accept(invitation *Invitation, user *User, roles ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update invitations
+		set accepted_at = now()
+		where id = $1
+		and accepted_at is null
+		and revoked_at is null
+		returning accepted_at
+	`
+	err = tx.QueryRowContext(ctx, query, invitation.ID).Scan(&invitation.AcceptedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if user.ID == 0 {
+		err = insertUser(ctx, tx, user, roles)
+		if err != nil {
+			return err
+		}
+	}
+
+	if invitation.WorkspaceID != 0 {
+		query = `
+			insert into workspace_members (workspace_id, user_id, role)
+			values ($1, $2, $3)
+			on conflict (workspace_id, user_id) do update set role = excluded.role
+		`
+		_, err = tx.ExecContext(ctx, query, invitation.WorkspaceID, user.ID, invitation.WorkspaceRole)
+		if err != nil {
+			return err
+		}
+		err = ensureOwner(ctx, tx, invitation.WorkspaceID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Revoke() cancels a pending invitation
+func (m InvitationModel) Revoke(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		update invitations
+		set revoked_at = now()
+		where id = $1
+		and accepted_at is null
+		and revoked_at is null
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
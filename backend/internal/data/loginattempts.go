@@ -0,0 +1,203 @@
+// Filename: MyReference/backend/internal/data/loginattempts.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Define the LoginAttempt type, a failure counter for an account or an IP address
+type LoginAttempt struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// IsLocked() checks if the lockout is still in effect
+func (a *LoginAttempt) IsLocked() bool {
+	return a.LockedUntil != nil && a.LockedUntil.After(time.Now())
+}
+
+// AccountAttemptKey() returns the counter key for an email address.
+// We key by email instead of user ID so unknown addresses are throttled the same way
+func AccountAttemptKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// IPAttemptKey() returns the counter key for an IP address
+func IPAttemptKey(ip net.IP) string {
+	return "ip:" + ip.String()
+}
+
+// Define the LockoutPolicy type
+type LockoutPolicy struct {
+	Threshold   int
+	Window      time.Duration
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// LockoutFor() returns how long to lock after the given number of failures.
+// The lockout doubles with each failure past the threshold, up to MaxDuration
+func (p LockoutPolicy) LockoutFor(failures int) time.Duration {
+	if p.Threshold < 1 || failures < p.Threshold {
+		return 0
+	}
+	lockout := p.Duration
+	for i := p.Threshold; i < failures; i++ {
+		lockout *= 2
+		if lockout >= p.MaxDuration {
+			return p.MaxDuration
+		}
+	}
+	return lockout
+}
+
+// Define the LoginAttempt model
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// Get() returns the counter for a key
+func (m LoginAttemptModel) Get(key string) (*LoginAttempt, error) {
+	query := `
+		select key, failures, last_failure_at, locked_until
+		from login_attempts
+		where key = $1
+	`
+	var attempt LoginAttempt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, key).Scan(
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailureAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &attempt, nil
+}
+
+// RecordFailure() increments the counter for a key and locks it once the policy threshold is reached.
+// Failures older than the policy window are forgotten
+func (m LoginAttemptModel) RecordFailure(key string, policy LockoutPolicy) (*LoginAttempt, error) {
+	query := `
+		insert into login_attempts (key, failures, last_failure_at)
+		values ($1, 1, now())
+		on conflict (key) do update
+		set failures = case
+			when login_attempts.last_failure_at < now() - make_interval(secs => $2) then 1
+			else login_attempts.failures + 1
+		end,
+		last_failure_at = now()
+		returning key, failures, last_failure_at, locked_until
+	`
+	var attempt LoginAttempt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, key, policy.Window.Seconds()).Scan(
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailureAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lockout := policy.LockoutFor(attempt.Failures)
+	if lockout == 0 {
+		return &attempt, nil
+	}
+
+	lockedUntil := time.Now().Add(lockout)
+	query = `
+		update login_attempts
+		set locked_until = $2
+		where key = $1
+	`
+	_, err = m.DB.ExecContext(ctx, query, key, lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	attempt.LockedUntil = &lockedUntil
+	return &attempt, nil
+}
+
+// Reset() clears the counter and any lockout for a key
+func (m LoginAttemptModel) Reset(key string) error {
+	query := `
+		delete from login_attempts
+		where key = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, key)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllLocked() returns every key that is currently locked out
+func (m LoginAttemptModel) GetAllLocked() ([]*LoginAttempt, error) {
+	query := `
+		select key, failures, last_failure_at, locked_until
+		from login_attempts
+		where locked_until > now()
+		order by locked_until desc
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []*LoginAttempt{}
+	for rows.Next() {
+		var attempt LoginAttempt
+		err := rows.Scan(
+			&attempt.Key,
+			&attempt.Failures,
+			&attempt.LastFailureAt,
+			&attempt.LockedUntil,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
@@ -0,0 +1,226 @@
+// Filename: MyReference/backend/internal/data/mfa.go
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// The number of one-time recovery codes handed out when 2FA is enabled
+const recoveryCodeCount = 10
+
+// Define the TOTP type which holds a user's authenticator enrolment
+type TOTP struct {
+	UserID       int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	Secret       string    `json:"-"`
+	Enabled      bool      `json:"enabled"`
+	LastUsedStep int64     `json:"-"`
+}
+
+// generateRecoveryCode() returns a code in the form xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	randomBytes := make([]byte, 10)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	return code[:5] + "-" + code[5:10], nil
+}
+
+// hashRecoveryCode() normalizes the code the way users tend to type it before hashing
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToLower(strings.TrimSpace(code))
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
+
+// Define the MFA model
+type MFAModel struct {
+	DB *sql.DB
+}
+
+// Get() returns the user's TOTP enrolment
+func (m MFAModel) Get(userID int64) (*TOTP, error) {
+	query := `
+		select user_id, created_at, secret, enabled, last_used_step
+		from users_totp
+		where user_id = $1
+	`
+	var totp TOTP
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.CreatedAt,
+		&totp.Secret,
+		&totp.Enabled,
+		&totp.LastUsedStep,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &totp, nil
+}
+
+// Enrol() stores a new, not yet enabled, secret for the user.
+// A pending enrolment is replaced but an enabled one is left untouched
+func (m MFAModel) Enrol(userID int64, secret string) error {
+	query := `
+		insert into users_totp (user_id, secret)
+		values ($1, $2)
+		on conflict (user_id) do update
+		set secret = excluded.secret, created_at = now(), last_used_step = 0
+		where users_totp.enabled = false
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
+
+// Enable() switches on 2FA once the first code has been verified
+func (m MFAModel) Enable(userID int64) error {
+	query := `
+		update users_totp
+		set enabled = true
+		where user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Disable() removes the enrolment and every recovery code
+func (m MFAModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `delete from users_totp where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseStep() records the time step of an accepted code.
+// It returns false if that step (or a later one) was already used, which stops replays
+func (m MFAModel) UseStep(userID int64, step int64) (bool, error) {
+	query := `
+		update users_totp
+		set last_used_step = $2
+		where user_id = $1 and last_used_step < $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// NewRecoveryCodes() replaces the user's recovery codes and returns the plaintext values
+func (m MFAModel) NewRecoveryCodes(userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		_, err = tx.ExecContext(ctx, `insert into recovery_codes (hash, user_id) values ($1, $2)`, hashRecoveryCode(code), userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode() marks an unused recovery code as used, returning false if there was none
+func (m MFAModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	query := `
+		update recovery_codes
+		set used_at = now()
+		where hash = $1 and user_id = $2 and used_at is null
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hashRecoveryCode(code), userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
@@ -4,6 +4,8 @@ package data
 import (
 	"database/sql"
 	"errors"
+
+	"mgomez.net/internal/cache"
 )
 
 var (
@@ -13,18 +15,40 @@ var (
 
 // A wrapper for our data models
 type Models struct {
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
-	Reference   ReferenceModel
+	Users          UserModel
+	Tokens         TokenModel
+	Permissions    PermissionModel
+	Reference      ReferenceModel
+	APIKeys        APIKeyModel
+	MFA            MFAModel
+	LoginAttempts  LoginAttemptModel
+	EmailChanges   EmailChangeModel
+	Impersonations ImpersonationModel
+	Roles          RoleModel
+	Workspaces     WorkspaceModel
+	Invitations    InvitationModel
+	Identities     IdentityModel
+	OIDCStates     OIDCStateModel
+	OAuth          OAuthModel
 }
 
-// NewModels() allows us to create a new model
-func NewModels(db *sql.DB) Models {
+// NewModels() allows us to create a new model, c caches the lookups made on every request and may be nil
+func NewModels(db *sql.DB, c *cache.Cache) Models {
 	return Models{
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Reference:   ReferenceModel{DB: db},
+		Users:          UserModel{DB: db, Cache: c},
+		Tokens:         TokenModel{DB: db, Cache: c},
+		Permissions:    PermissionModel{DB: db, Cache: c},
+		Reference:      ReferenceModel{DB: db},
+		APIKeys:        APIKeyModel{DB: db},
+		MFA:            MFAModel{DB: db},
+		LoginAttempts:  LoginAttemptModel{DB: db},
+		EmailChanges:   EmailChangeModel{DB: db},
+		Impersonations: ImpersonationModel{DB: db},
+		Roles:          RoleModel{DB: db, Cache: c},
+		Workspaces:     WorkspaceModel{DB: db},
+		Invitations:    InvitationModel{DB: db},
+		Identities:     IdentityModel{DB: db},
+		OIDCStates:     OIDCStateModel{DB: db},
+		OAuth:          OAuthModel{DB: db},
 	}
 }
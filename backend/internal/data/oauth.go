@@ -0,0 +1,432 @@
+// Filename: MyReference/backend/internal/data/oauth.go
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"mgomez.net/internal/validator"
+)
+
+// OAuth access tokens are 32 random bytes, so they are twice as long as session tokens
+const OAuthTokenLength = 52
+
+// Define the OAuthClient type, a third-party application registered to act for users
+type OAuthClient struct {
+	ID           int64       `json:"id"`
+	CreatedAt    time.Time   `json:"created_at"`
+	ClientID     string      `json:"client_id"`
+	Secret       string      `json:"client_secret,omitempty"`
+	Name         string      `json:"name"`
+	RedirectURIs []string    `json:"redirect_uris"`
+	Scopes       Permissions `json:"scopes"`
+	Confidential bool        `json:"confidential"`
+	OwnerID      int64       `json:"-"`
+	secretHash   []byte
+}
+
+// AllowsRedirect() checks the redirect URI exactly matches one registered for the client
+func (c *OAuthClient) AllowsRedirect(redirectURI string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateOAuthClient() validates the client registration against the owner's permissions
+func ValidateOAuthClient(v *validator.Validator, client *OAuthClient, ownerPermissions Permissions) {
+	v.Check(client.Name != "", "name", "must be provided")
+	v.Check(len(client.Name) <= 100, "name", "must not be more than 100 characters long")
+
+	v.Check(len(client.RedirectURIs) <= 10, "redirect_uris", "must not contain more than 10 entries")
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		v.Check(err == nil && u.IsAbs() && u.Fragment == "", "redirect_uris", "must only contain absolute URLs without a fragment")
+	}
+	//Only confidential clients can use the client credentials grant, which needs no redirect
+	if !client.Confidential {
+		v.Check(len(client.RedirectURIs) >= 1, "redirect_uris", "must contain at least one URL")
+	}
+
+	v.Check(len(client.Scopes) >= 1, "scopes", "must contain at least one permission")
+	v.Check(validator.Unique(client.Scopes), "scopes", "must not contain duplicate values")
+	for _, code := range client.Scopes {
+		v.Check(ownerPermissions.Include(code), "scopes", "must only contain permissions you have been granted")
+	}
+}
+
+// Define the OAuthCode type, an authorization code waiting to be exchanged for a token
+type OAuthCode struct {
+	ClientID      int64
+	UserID        int64
+	RedirectURI   string
+	Scopes        Permissions
+	CodeChallenge string
+	Expiry        time.Time
+}
+
+// Define the OAuthToken type, an access token issued to a client
+type OAuthToken struct {
+	Plaintext string      `json:"access_token"`
+	Hash      []byte      `json:"-"`
+	CreatedAt time.Time   `json:"-"`
+	ClientID  int64       `json:"-"`
+	UserID    int64       `json:"-"`
+	Scopes    Permissions `json:"-"`
+	Expiry    time.Time   `json:"-"`
+}
+
+// randomSecret() returns 32 random bytes encoded the same way as API keys, along with its hash
+func randomSecret() (string, []byte, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(plaintext))
+	return plaintext, hash[:], nil
+}
+
+// Define the OAuth model, holding clients, authorization codes and access tokens
+type OAuthModel struct {
+	DB *sql.DB
+}
+
+// NewClient() registers the client. The secret of confidential clients is only returned here
+func (m OAuthModel) NewClient(client *OAuthClient) error {
+	idBytes := make([]byte, 16)
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		return err
+	}
+	client.ClientID = hex.EncodeToString(idBytes)
+
+	if client.Confidential {
+		client.Secret, client.secretHash, err = randomSecret()
+		if err != nil {
+			return err
+		}
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+
+	query := `
+		insert into oauth_clients (client_id, secret_hash, name, redirect_uris, scopes, owner_id)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id, created_at
+	`
+	args := []interface{}{
+		client.ClientID,
+		client.secretHash,
+		client.Name,
+		pq.Array(client.RedirectURIs),
+		pq.Array([]string(client.Scopes)),
+		client.OwnerID,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&client.ID, &client.CreatedAt)
+}
+
+// GetClient() returns the client with the public client id
+func (m OAuthModel) GetClient(clientID string) (*OAuthClient, error) {
+	query := `
+		select id, created_at, client_id, secret_hash, name, redirect_uris, scopes, owner_id
+		from oauth_clients
+		where client_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var client OAuthClient
+	err := m.DB.QueryRowContext(ctx, query, clientID).Scan(
+		&client.ID,
+		&client.CreatedAt,
+		&client.ClientID,
+		&client.secretHash,
+		&client.Name,
+		pq.Array(&client.RedirectURIs),
+		pq.Array((*[]string)(&client.Scopes)),
+		&client.OwnerID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	client.Confidential = client.secretHash != nil
+	return &client, nil
+}
+
+// AuthenticateClient() returns the client if the secret is right. Public clients authenticate with their id alone
+func (m OAuthModel) AuthenticateClient(clientID, secret string) (*OAuthClient, error) {
+	client, err := m.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !client.Confidential {
+		if secret != "" {
+			return nil, ErrRecordNotFound
+		}
+		return client, nil
+	}
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], client.secretHash) != 1 {
+		return nil, ErrRecordNotFound
+	}
+	return client, nil
+}
+
+// GetAllClients() returns every registered client
+func (m OAuthModel) GetAllClients() ([]*OAuthClient, error) {
+	query := `
+		select id, created_at, client_id, secret_hash, name, redirect_uris, scopes, owner_id
+		from oauth_clients
+		order by id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*OAuthClient{}
+	for rows.Next() {
+		var client OAuthClient
+		err := rows.Scan(
+			&client.ID,
+			&client.CreatedAt,
+			&client.ClientID,
+			&client.secretHash,
+			&client.Name,
+			pq.Array(&client.RedirectURIs),
+			pq.Array((*[]string)(&client.Scopes)),
+			&client.OwnerID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		client.Confidential = client.secretHash != nil
+		clients = append(clients, &client)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteClient() removes the client along with its codes and tokens
+func (m OAuthModel) DeleteClient(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		delete from oauth_clients
+		where id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// NewCode() stores an authorization code the user consented to and returns its plaintext
+func (m OAuthModel) NewCode(code *OAuthCode, ttl time.Duration) (string, error) {
+	token, err := generateToken(code.UserID, ttl, "")
+	if err != nil {
+		return "", err
+	}
+	code.Expiry = token.Expiry
+
+	query := `
+		insert into oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expiry)
+		values ($1, $2, $3, $4, $5, $6, $7)
+	`
+	args := []interface{}{
+		token.Hash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		pq.Array([]string(code.Scopes)),
+		code.CodeChallenge,
+		code.Expiry,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	return token.Plaintext, nil
+}
+
+// TakeCode() returns and removes an unexpired authorization code, so each code can only be exchanged once
+func (m OAuthModel) TakeCode(plaintext string) (*OAuthCode, error) {
+	codeHash := sha256.Sum256([]byte(plaintext))
+	query := `
+		delete from oauth_codes
+		where code_hash = $1
+		returning client_id, user_id, redirect_uri, scopes, code_challenge, expiry
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var code OAuthCode
+	err := m.DB.QueryRowContext(ctx, query, codeHash[:]).Scan(
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		pq.Array((*[]string)(&code.Scopes)),
+		&code.CodeChallenge,
+		&code.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if time.Now().After(code.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+	return &code, nil
+}
+
+// NewToken() issues an access token to the client acting for the user
+func (m OAuthModel) NewToken(clientID, userID int64, scopes Permissions, ttl time.Duration) (*OAuthToken, error) {
+	plaintext, hash, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+	token := &OAuthToken{
+		Plaintext: plaintext,
+		Hash:      hash,
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	query := `
+		insert into oauth_tokens (token_hash, client_id, user_id, scopes, expiry)
+		values ($1, $2, $3, $4, $5)
+		returning created_at
+	`
+	args := []interface{}{
+		token.Hash,
+		token.ClientID,
+		token.UserID,
+		pq.Array([]string(token.Scopes)),
+		token.Expiry,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetForToken() returns an unexpired access token together with the user it acts for
+func (m OAuthModel) GetForToken(plaintext string) (*OAuthToken, *User, error) {
+	tokenHash := sha256.Sum256([]byte(plaintext))
+	query := `
+		select oauth_tokens.created_at, oauth_tokens.client_id, oauth_tokens.scopes, oauth_tokens.expiry,
+			users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		from oauth_tokens
+		inner join users on users.id = oauth_tokens.user_id
+		where oauth_tokens.token_hash = $1
+		and oauth_tokens.expiry > $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	token := OAuthToken{Plaintext: plaintext, Hash: tokenHash[:]}
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()).Scan(
+		&token.CreatedAt,
+		&token.ClientID,
+		pq.Array((*[]string)(&token.Scopes)),
+		&token.Expiry,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	token.UserID = user.ID
+	return &token, &user, nil
+}
+
+// RevokeToken() deletes an access token issued to the client. Tokens of other clients are left alone
+func (m OAuthModel) RevokeToken(plaintext string, clientID int64) error {
+	tokenHash := sha256.Sum256([]byte(plaintext))
+	query := `
+		delete from oauth_tokens
+		where token_hash = $1 and client_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:], clientID)
+	return err
+}
+
+// DeleteAllTokensForUser() revokes every access token acting for the user
+func (m OAuthModel) DeleteAllTokensForUser(userID int64) error {
+	query := `
+		delete from oauth_tokens
+		where user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
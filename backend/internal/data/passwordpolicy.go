@@ -0,0 +1,194 @@
+// Filename: MyReference/backend/internal/data/passwordpolicy.go
+package data
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"mgomez.net/internal/validator"
+)
+
+// Define the PasswordPolicy type which holds the rules applied to new passwords
+type PasswordPolicy struct {
+	MinEntropy         float64
+	RejectPersonalInfo bool
+	Breached           *BreachedPasswords
+}
+
+var (
+	policyMu      sync.RWMutex
+	currentPolicy = PasswordPolicy{RejectPersonalInfo: true}
+)
+
+// SetPasswordPolicy() changes the rules applied to new passwords
+func SetPasswordPolicy(policy PasswordPolicy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	currentPolicy = policy
+}
+
+// passwordPolicy() returns the rules applied to new passwords
+func passwordPolicy() PasswordPolicy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return currentPolicy
+}
+
+// Validate() runs every rule of the policy, each rule reports under its own key
+func (p PasswordPolicy) Validate(v *validator.Validator, password string, personalInfo ...string) {
+	if p.MinEntropy > 0 {
+		v.Check(PasswordEntropy(password) >= p.MinEntropy, "password_strength", "is too easy to guess, use a longer password with a mix of character types")
+	}
+	if p.RejectPersonalInfo {
+		v.Check(!containsPersonalInfo(password, personalInfo), "password_personal_info", "must not contain your name or email address")
+	}
+	if p.Breached != nil {
+		v.Check(!p.Breached.Contains(password), "password_breached", "has appeared in a data breach, please choose a different password")
+	}
+}
+
+// PasswordEntropy() estimates the strength of a password in bits.
+// Each character adds log2 of the size of the character pool in use, but repeated
+// characters and simple sequences such as "abc" or "123" add nothing
+func PasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	effectiveLength := 0
+	var previous rune
+	for i, r := range []rune(password) {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+		if i == 0 || (r != previous && r != previous+1 && r != previous-1) {
+			effectiveLength++
+		}
+		previous = r
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(effectiveLength) * math.Log2(float64(pool))
+}
+
+// containsPersonalInfo() checks the password for the user's name, the words of their name,
+// their email address and the local part of their email address
+func containsPersonalInfo(password string, personalInfo []string) bool {
+	password = strings.ToLower(password)
+
+	var candidates []string
+	for _, info := range personalInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+		candidates = append(candidates, info)
+		if at := strings.LastIndex(info, "@"); at > 0 {
+			candidates = append(candidates, info[:at])
+		}
+		candidates = append(candidates, strings.FieldsFunc(info, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+
+	for _, candidate := range candidates {
+		//very short fragments would reject too many good passwords
+		if len(candidate) >= 3 && strings.Contains(password, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// BreachedPasswords holds SHA-1 hashes of known breached passwords.
+// Like the k-anonymity range API, hashes are bucketed by their first five hex characters
+type BreachedPasswords struct {
+	buckets map[string]map[string]struct{}
+	count   int
+}
+
+// LoadBreachedPasswords() reads a file with one upper or lower case hex SHA-1 hash per line.
+// An optional ":count" suffix is ignored, as are blank lines and lines starting with #
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	breached := &BreachedPasswords{buckets: make(map[string]map[string]struct{})}
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.ToUpper(line)
+		if _, err := hex.DecodeString(line); err != nil || len(line) != 40 {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, lineNumber)
+		}
+
+		prefix, suffix := line[:5], line[5:]
+		if breached.buckets[prefix] == nil {
+			breached.buckets[prefix] = make(map[string]struct{})
+		}
+		breached.buckets[prefix][suffix] = struct{}{}
+		breached.count++
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return breached, nil
+}
+
+// Len() returns the number of hashes loaded
+func (b *BreachedPasswords) Len() int {
+	return b.count
+}
+
+// Contains() checks if the password is in the list
+func (b *BreachedPasswords) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	bucket, ok := b.buckets[hash[:5]]
+	if !ok {
+		return false
+	}
+	_, found := bucket[hash[5:]]
+	return found
+}
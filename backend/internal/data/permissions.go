@@ -8,6 +8,7 @@ import (
 
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
+	"mgomez.net/internal/cache"
 )
 
 // Define a slice to hold the permissions codes
@@ -24,29 +25,64 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *cache.Cache
 }
 
+// GetAllForUser() returns the permissions granted to the user directly and through their roles.
+// They are checked on most requests, so they are cached
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	var permissions Permissions
+	if m.Cache.Get(permissionsCacheKey(userID), &permissions) {
+		return permissions, nil
+	}
+
 	query := `
-		select permissions.code 
+		select permissions.code
 		from permissions
 		inner join users_permissions
-		on users_permissions.permission_id = permissions.id
-		inner join users
-		on users_permissions.id = users.id
-		where users.id = $1
+		on users_permissions.permissions_id = permissions.id
+		where users_permissions.user_id = $1
+		union
+		select permissions.code
+		from permissions
+		inner join roles_permissions
+		on roles_permissions.permissions_id = permissions.id
+		inner join users_roles
+		on users_roles.role_id = roles_permissions.role_id
+		where users_roles.user_id = $1
+		order by code
+	`
+
+	permissions, err := m.queryCodes(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	m.Cache.Set(permissionsCacheKey(userID), permissions, 0)
+	return permissions, nil
+}
+
+// GetAll() returns every permission code that can be granted
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+		select distinct code
+		from permissions
+		order by code
 	`
+	return m.queryCodes(query)
+}
 
+// queryCodes() runs a query that selects a single column of permission codes
+func (m PermissionModel) queryCodes(query string, args ...interface{}) (Permissions, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var permissions Permissions
+	permissions := Permissions{}
 	for rows.Next() {
 		var permisison string
 		err := rows.Scan(&permisison)
@@ -67,10 +103,44 @@ func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 		select $1, permissions.id
 		from permissions 
 		where permissions.code = any($2)
+		on conflict do nothing
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
+	if err != nil {
+		return err
+	}
+	invalidateUser(m.Cache, userID)
+	return nil
+}
+
+// RemoveForUser() revokes permissions granted directly to the user, role permissions are not affected
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+		delete from users_permissions
+		using permissions
+		where users_permissions.permissions_id = permissions.id
+		and users_permissions.user_id = $1
+		and permissions.code = any($2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+	invalidateUser(m.Cache, userID)
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
 }
@@ -11,11 +11,13 @@ import (
 )
 
 type Reference struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Name      string    `json:"name"`
-	Location  string    `json:"storage-location"`
-	Version   int32     `json:"version"`
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	UserID      int64     `json:"-"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Name        string    `json:"name"`
+	Location    string    `json:"storage-location"`
+	Version     int32     `json:"version"`
 }
 
 // validation for reference input
@@ -29,49 +31,52 @@ func ValidateReference(v *validator.Validator, reference *Reference) {
 
 // Defining the model struct for reference
 type ReferenceModel struct {
-	DB *sql.DB
+	DB  *sql.DB
+	ctx context.Context
 }
 
 // CRUD functions
 // Insert (Create)
 func (m ReferenceModel) Insert(reference *Reference) error {
 	query := `
-		insert into reference_info (name, location)
-		values ($1, $2)
+		insert into reference_info (name, location, user_id, workspace_id)
+		values ($1, $2, $3, $4)
 		returning id, created_at, version
 	`
 
 	//preparing the arguments
 	args := []interface{}{
-		reference.Name, reference.Location,
+		reference.Name, reference.Location, reference.UserID, reference.WorkspaceID,
 	}
 	//creating the context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "ReferenceModel.Insert")
 	defer cancel()
 	return m.DB.QueryRowContext(ctx, query, args...).Scan(&reference.ID, &reference.CreatedAt, &reference.Version)
 }
 
-// Get (Read)
-func (m ReferenceModel) Get(id int64) (*Reference, error) {
+// Get (Read), only references inside the workspace are found
+func (m ReferenceModel) Get(id, workspaceID int64) (*Reference, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	//Creating the query
 	query := `
-		select id, created_at, name, location, version
+		select id, created_at, coalesce(user_id, 0), workspace_id, name, location, version
 		from reference_info
-		where id = $1
+		where id = $1 and workspace_id = $2
 	`
 	//creating an instance to hold the info
 	var reference Reference
 
 	//dealing with context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "ReferenceModel.Get")
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id, workspaceID).Scan(
 		&reference.ID,
 		&reference.CreatedAt,
+		&reference.UserID,
+		&reference.WorkspaceID,
 		&reference.Name,
 		&reference.Location,
 		&reference.Version,
@@ -90,6 +95,46 @@ func (m ReferenceModel) Get(id int64) (*Reference, error) {
 	return &reference, nil
 }
 
+// GetAllForUser returns every reference owned by the user
+func (m ReferenceModel) GetAllForUser(userID int64) ([]*Reference, error) {
+	query := `
+		select id, created_at, coalesce(user_id, 0), workspace_id, name, location, version
+		from reference_info
+		where user_id = $1
+		order by id
+	`
+	ctx, cancel := queryContext(m.ctx, "ReferenceModel.GetAllForUser")
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	references := []*Reference{}
+	for rows.Next() {
+		var reference Reference
+		err := rows.Scan(
+			&reference.ID,
+			&reference.CreatedAt,
+			&reference.UserID,
+			&reference.WorkspaceID,
+			&reference.Name,
+			&reference.Location,
+			&reference.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		references = append(references, &reference)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return references, nil
+}
+
 // Update
 func (m ReferenceModel) Update(reference *Reference) error {
 	query := `
@@ -106,7 +151,7 @@ func (m ReferenceModel) Update(reference *Reference) error {
 		reference.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "ReferenceModel.Update")
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&reference.Version)
@@ -121,18 +166,18 @@ func (m ReferenceModel) Update(reference *Reference) error {
 	return nil
 }
 
-// Delete
-func (m ReferenceModel) Delete(id int64) error {
+// Delete, only references inside the workspace can be deleted
+func (m ReferenceModel) Delete(id, workspaceID int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 	query := `
 		delete from reference_info
-		where id = $1
+		where id = $1 and workspace_id = $2
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "ReferenceModel.Delete")
 	defer cancel()
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, workspaceID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,266 @@
+// Filename: MyReference/backend/internal/data/roles.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"mgomez.net/internal/cache"
+	"mgomez.net/internal/validator"
+)
+
+var (
+	ErrDuplicateRole = errors.New("duplicate role")
+)
+
+// Define the Role type, a named bundle of permission codes
+type Role struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Code        string      `json:"code"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// ValidateRole() validates the role input against the permission codes that exist
+func ValidateRole(v *validator.Validator, role *Role, known Permissions) {
+	v.Check(role.Code != "", "code", "must be provided")
+	v.Check(len(role.Code) <= 50, "code", "must not be more than 50 characters long")
+	v.Check(len(role.Description) <= 500, "description", "must not be more than 500 characters long")
+
+	v.Check(len(role.Permissions) >= 1, "permissions", "must contain at least one permission")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range role.Permissions {
+		v.Check(known.Include(code), "permissions", "must only contain existing permission codes")
+	}
+}
+
+// Define the Role model
+type RoleModel struct {
+	DB    *sql.DB
+	Cache *cache.Cache
+}
+
+// Insert() creates the role together with its permissions
+func (m RoleModel) Insert(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		insert into roles (code, description)
+		values ($1, $2)
+		returning id, created_at
+	`
+	err = tx.QueryRowContext(ctx, query, role.Code, role.Description).Scan(&role.ID, &role.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_code_key"`:
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	query = `
+		insert into roles_permissions
+		select $1, permissions.id
+		from permissions
+		where permissions.code = any($2)
+		on conflict do nothing
+	`
+	_, err = tx.ExecContext(ctx, query, role.ID, pq.Array([]string(role.Permissions)))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAll() returns every role with its permissions
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+		select roles.id, roles.created_at, roles.code, roles.description,
+		coalesce(array_agg(distinct permissions.code) filter (where permissions.code is not null), '{}')
+		from roles
+		left join roles_permissions
+		on roles_permissions.role_id = roles.id
+		left join permissions
+		on permissions.id = roles_permissions.permissions_id
+		group by roles.id
+		order by roles.code
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(
+			&role.ID,
+			&role.CreatedAt,
+			&role.Code,
+			&role.Description,
+			pq.Array((*[]string)(&role.Permissions)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// Get() returns the role with the code together with its permissions
+func (m RoleModel) Get(code string) (*Role, error) {
+	query := `
+		select roles.id, roles.created_at, roles.code, roles.description,
+		coalesce(array_agg(distinct permissions.code) filter (where permissions.code is not null), '{}')
+		from roles
+		left join roles_permissions
+		on roles_permissions.role_id = roles.id
+		left join permissions
+		on permissions.id = roles_permissions.permissions_id
+		where roles.code = $1
+		group by roles.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role Role
+	err := m.DB.QueryRowContext(ctx, query, code).Scan(
+		&role.ID,
+		&role.CreatedAt,
+		&role.Code,
+		&role.Description,
+		pq.Array((*[]string)(&role.Permissions)),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &role, nil
+}
+
+// GetAllForUser() returns the codes of the roles assigned to the user
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+	query := `
+		select roles.code
+		from roles
+		inner join users_roles
+		on users_roles.role_id = roles.id
+		where users_roles.user_id = $1
+		order by roles.code
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []string{}
+	for rows.Next() {
+		var code string
+		err := rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// AddForUser() assigns a role to the user, assigning it twice is not an error
+func (m RoleModel) AddForUser(userID int64, code string) error {
+	query := `
+		insert into users_roles
+		select $1, roles.id
+		from roles
+		where roles.code = $2
+		on conflict do nothing
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+	invalidateUser(m.Cache, userID)
+
+	//Nothing is inserted when the role does not exist, so check for it
+	exists, err := m.Exists(code)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Exists() reports whether a role with the code has been created
+func (m RoleModel) Exists(code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, `select exists (select 1 from roles where code = $1)`, code).Scan(&exists)
+	return exists, err
+}
+
+// RemoveForUser() takes a role away from the user
+func (m RoleModel) RemoveForUser(userID int64, code string) error {
+	query := `
+		delete from users_roles
+		using roles
+		where users_roles.role_id = roles.id
+		and users_roles.user_id = $1
+		and roles.code = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+	invalidateUser(m.Cache, userID)
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
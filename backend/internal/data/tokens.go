@@ -9,6 +9,7 @@ import (
 	"encoding/base32"
 	"time"
 
+	"mgomez.net/internal/cache"
 	"mgomez.net/internal/validator"
 )
 
@@ -16,6 +17,12 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeMFAChallenge   = "mfa-challenge"
+	ScopeUnlock         = "unlock"
+	ScopeEmailChange    = "email-change"
+	ScopePasswordReset  = "password-reset"
+	ScopeImpersonation  = "impersonation"
+	ScopeInvitation     = "invitation"
 )
 
 // Define the Token type
@@ -60,7 +67,9 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 
 // Define the Token model
 type TokenModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *cache.Cache
+	ctx   context.Context
 }
 
 // Create and insert a token into the tokens table
@@ -85,7 +94,7 @@ func (m TokenModel) Insert(token *Token) error {
 		token.Expiry,
 		token.Scope,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "TokenModel.Insert")
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -98,8 +107,61 @@ func (m TokenModel) DeleteAllForUsers(scope string, userID int64) error {
 		where scope = $1 and user_id = $2
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "TokenModel.DeleteAllForUsers")
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
-	return err
+	if err != nil {
+		return err
+	}
+	invalidateUser(m.Cache, userID)
+	return nil
+}
+
+// DeleteAllForUser removes every token the user holds whatever its scope
+func (m TokenModel) DeleteAllForUser(userID int64) error {
+	query := `
+		delete from tokens
+		where user_id = $1
+	`
+
+	ctx, cancel := queryContext(m.ctx, "TokenModel.DeleteAllForUser")
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	invalidateUser(m.Cache, userID)
+	return nil
+}
+
+// GetAllForUser returns the scope and expiry of every token the user holds
+func (m TokenModel) GetAllForUser(userID int64) ([]*Token, error) {
+	query := `
+		select user_id, expiry, scope
+		from tokens
+		where user_id = $1
+		order by expiry
+	`
+	ctx, cancel := queryContext(m.ctx, "TokenModel.GetAllForUser")
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		var token Token
+		err := rows.Scan(&token.UserID, &token.Expiry, &token.Scope)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
 }
@@ -0,0 +1,33 @@
+// Filename: MyReference/backend/internal/data/tracing.go
+package data
+
+import (
+	"context"
+	"time"
+
+	"mgomez.net/internal/tracing"
+)
+
+// WithContext() returns models whose queries run under ctx, so they are cancelled along with
+// the request and traced as part of it
+func (m Models) WithContext(ctx context.Context) Models {
+	m.Users.ctx = ctx
+	m.Tokens.ctx = ctx
+	m.Reference.ctx = ctx
+	return m
+}
+
+// queryContext() returns the context a query runs under, with the usual timeout and a child
+// span of the request's trace. The cancel function also ends the span
+func queryContext(parent context.Context, name string) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, span := tracing.StartChild(parent, name, tracing.KindClient)
+	span.SetAttribute("db.system", "postgresql")
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	return ctx, func() {
+		cancel()
+		span.Finish()
+	}
+}
@@ -3,12 +3,15 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"mgomez.net/internal/cache"
 	"mgomez.net/internal/validator"
 )
 
@@ -36,48 +39,85 @@ func (u *User) IsAnonymous() bool {
 
 // creating a password type
 type password struct {
-	plaintext *string
-	hash      []byte
+	plaintext   *string
+	hash        []byte
+	needsRehash bool
 }
 
 // Set() method stores the hash of the plaintext password
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := passwordHasher().Hash(plaintextPassword)
 	if err != nil {
 		return err
 	}
 
 	p.plaintext = &plaintextPassword
 	p.hash = hash
+	p.needsRehash = false
 
 	return nil
 }
 
-// Matches() checks if the supplied password is correct
+// Invalidate() replaces the hash with one of a random password nobody knows,
+// so the user can only sign in again after resetting their password
+func (p *password) Invalidate() error {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	err = p.Set(base64.RawStdEncoding.EncodeToString(randomBytes))
+	p.plaintext = nil
+	return err
+}
+
+// Matches() checks if the supplied password is correct.
+// It also notes if the stored hash was made with an outdated algorithm or cost
 func (p *password) Matches(plaintextPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
+	hasher, err := hasherFor(p.hash)
 	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
-		}
+		return false, err
+	}
+
+	match, err := hasher.Compare(p.hash, plaintextPassword)
+	if err != nil || !match {
+		return false, err
 	}
+
+	current := passwordHasher()
+	p.needsRehash = !current.Recognizes(p.hash) || current.Outdated(p.hash)
 	return true, nil
 }
 
+// NeedsRehash() reports whether the last successful Matches() found an outdated hash
+func (p *password) NeedsRehash() bool {
+	return p.needsRehash
+}
+
 // ValidateEmail() validates the user email input
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
 }
 
-// ValidatePasswordPlaintext() validates if the password follows the rules
-func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+// ValidatePasswordInput() only checks that a password was supplied, it is used when
+// logging in so passwords set under an older policy keep working
+func ValidatePasswordInput(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	maxLength := passwordHasher().MaxLength()
+	v.Check(len(password) <= maxLength, "password", fmt.Sprintf("must not be more than %d characters long", maxLength))
+}
+
+// ValidatePasswordPlaintext() validates if the password follows the rules.
+// personalInfo holds the user's name and email which the password must not contain
+func ValidatePasswordPlaintext(v *validator.Validator, password string, personalInfo ...string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be atleast 8 characters long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 characters long")
+	maxLength := passwordHasher().MaxLength()
+	v.Check(len(password) <= maxLength, "password", fmt.Sprintf("must not be more than %d characters long", maxLength))
+
+	//Apply the configurable policy rules
+	passwordPolicy().Validate(v, password, personalInfo...)
 }
 
 // ValidateUser() validates user input
@@ -90,7 +130,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 	//Checking the password
 	if user.Password.plaintext != nil {
-		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+		ValidatePasswordPlaintext(v, *user.Password.plaintext, user.Name, user.Email)
 	}
 
 	//Ensuring a hash was created for the password
@@ -101,11 +141,32 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 // Creating our DB model
 type UserModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *cache.Cache
+	ctx   context.Context
+}
+
+// Insert() for user, the user is given the listed roles in the same transaction
+func (m UserModel) Insert(user *User, roles ...string) error {
+	ctx, cancel := queryContext(m.ctx, "UserModel.Insert")
+	defer cancel()
+
+	//The user and their roles are saved together, a user is never left without the roles they were given
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertUser(ctx, tx, user, roles)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Insert() for user
-func (m UserModel) Insert(user *User) error {
+// insertUser() inserts the user and gives them the roles inside the caller's transaction
+func insertUser(ctx context.Context, tx *sql.Tx, user *User, roles []string) error {
 	query := `
 		insert into users (name, email, password_hash, activated)
 		values ($1, $2, $3, $4)
@@ -118,10 +179,7 @@ func (m UserModel) Insert(user *User) error {
 		user.Activated,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -130,9 +188,113 @@ func (m UserModel) Insert(user *User) error {
 			return err
 		}
 	}
+
+	query = `
+		insert into users_roles
+		select $1, roles.id
+		from roles
+		where roles.code = $2
+	`
+	for _, code := range roles {
+		result, err := tx.ExecContext(ctx, query, user.ID, code)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("role %q does not exist", code)
+		}
+	}
 	return nil
 }
 
+// Get() retrieves a user based on id
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		select id, created_at, name, email, password_hash, activated, version
+		from users
+		where id = $1
+	`
+	var user User
+
+	ctx, cancel := queryContext(m.ctx, "UserModel.Get")
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetAll() returns a page of users filtered by name, email and activation status
+func (m UserModel) GetAll(name string, email string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		select count(*) over(), id, created_at, name, email, password_hash, activated, version
+		from users
+		where (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) or $1 = '')
+		and (strpos(lower(email), lower($2)) > 0 or $2 = '')
+		and ($3::boolean is null or activated = $3)
+		order by %s %s, id asc
+		limit $4 offset $5
+	`, filters.sortColumn(), filters.sortOrder())
+
+	ctx, cancel := queryContext(m.ctx, "UserModel.GetAll")
+	defer cancel()
+
+	args := []interface{}{name, email, activated, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return users, metadata, nil
+}
+
 // GetByEmail() retrieves a user based on email
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
@@ -142,7 +304,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	`
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "UserModel.GetByEmail")
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
@@ -182,7 +344,7 @@ func (m UserModel) Update(user *User) error {
 		user.ID,
 		user.Version,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "UserModel.Update")
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
@@ -190,18 +352,58 @@ func (m UserModel) Update(user *User) error {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	invalidateUser(m.Cache, user.ID)
+	return nil
+}
+
+// UpgradePassword() re-hashes the password with the current algorithm after a successful login.
+// The update only applies if the stored hash has not changed in the meantime
+func (m UserModel) UpgradePassword(user *User, plaintextPassword string) error {
+	oldHash := user.Password.hash
+	err := user.Password.Set(plaintextPassword)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		update users
+		set password_hash = $1, version = version + 1
+		where id = $2 and password_hash = $3
+		returning version
+	`
+	ctx, cancel := queryContext(m.ctx, "UserModel.UpgradePassword")
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, user.Password.hash, user.ID, oldHash).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
 		default:
 			return err
 		}
 	}
+	invalidateUser(m.Cache, user.ID)
 	return nil
 }
 
-// GetForToken()
+// GetForToken() finds the user holding an unexpired token. Authentication tokens are looked up
+// on every request, so those are cached
 func (m UserModel) GetForToken(tokenScope, TokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(TokenPlaintext))
+	if tokenScope == ScopeAuthentication {
+		if user, found := cachedUserForToken(m.Cache, tokenHash[:]); found {
+			return user, nil
+		}
+	}
 	query := `
-		select users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		select users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, tokens.expiry
 		from users
 		inner join tokens
 		on users.id = tokens.user_id
@@ -212,10 +414,28 @@ func (m UserModel) GetForToken(tokenScope, TokenPlaintext string) (*User, error)
 	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
 
 	var user User
+	var expiry time.Time
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(m.ctx, "UserModel.GetForToken")
 	defer cancel()
 
+	//The user's generation is read before the user, so a change made while the user is being
+	//read moves the generation on and the copy read before it is never cached
+	var generation string
+	if tokenScope == ScopeAuthentication && m.Cache != nil {
+		var userID int64
+		err := m.DB.QueryRowContext(ctx, `select user_id from tokens where hash = $1 and scope = $2 and expiry > $3`, args...).Scan(&userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, ErrRecordNotFound
+			default:
+				return nil, err
+			}
+		}
+		generation = userGeneration(m.Cache, userID)
+	}
+
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
 		&user.ID,
 		&user.CreatedAt,
@@ -224,6 +444,7 @@ func (m UserModel) GetForToken(tokenScope, TokenPlaintext string) (*User, error)
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&expiry,
 	)
 
 	if err != nil {
@@ -234,5 +455,97 @@ func (m UserModel) GetForToken(tokenScope, TokenPlaintext string) (*User, error)
 			return nil, err
 		}
 	}
+	if generation != "" {
+		cacheUserForToken(m.Cache, tokenHash[:], &user, expiry, generation)
+	}
 	return &user, nil
 }
+
+// Delete() removes the user, the foreign keys cascade to everything the user owns.
+// Returns ErrLastOwner while the user is the only owner of a workspace shared with others
+func (m UserModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := queryContext(m.ctx, "UserModel.Delete")
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//Leave every workspace first, the workspaces nobody else belongs to go with the account
+	query := `
+		delete from workspace_members
+		where user_id = $1
+		returning workspace_id
+	`
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	workspaceIDs := []int64{}
+	for rows.Next() {
+		var workspaceID int64
+		err := rows.Scan(&workspaceID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		workspaceIDs = append(workspaceIDs, workspaceID)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	for _, workspaceID := range workspaceIDs {
+		query = `
+			delete from workspaces
+			where id = $1
+			and not exists (select 1 from workspace_members where workspace_id = $1)
+		`
+		result, err := tx.ExecContext(ctx, query, workspaceID)
+		if err != nil {
+			return err
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		//A workspace shared with others must keep an owner, ownership is handed over before leaving
+		if deleted == 0 {
+			err = ensureOwner(ctx, tx, workspaceID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	query = `
+		delete from users
+		where id = $1
+	`
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	invalidateUser(m.Cache, id)
+	return nil
+}
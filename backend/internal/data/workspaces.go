@@ -0,0 +1,392 @@
+// Filename: MyReference/backend/internal/data/workspaces.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"mgomez.net/internal/validator"
+)
+
+var (
+	ErrLastOwner = errors.New("workspace must keep at least one owner")
+)
+
+// The roles a member can hold inside a workspace, from least to most privileged
+const (
+	WorkspaceViewer = "viewer"
+	WorkspaceEditor = "editor"
+	WorkspaceOwner  = "owner"
+)
+
+var workspaceRoleRank = map[string]int{
+	WorkspaceViewer: 1,
+	WorkspaceEditor: 2,
+	WorkspaceOwner:  3,
+}
+
+// The permission codes each workspace role grants inside its workspace.
+// A code that appears here is only usable within a workspace the user is a member of
+var workspaceRolePermissions = map[string]Permissions{
+	WorkspaceViewer: {"reference:read"},
+	WorkspaceEditor: {"reference:read", "reference:write"},
+	WorkspaceOwner:  {"reference:read", "reference:write"},
+}
+
+// WorkspaceScoped() reports whether the permission code is evaluated against workspace membership
+func WorkspaceScoped(code string) bool {
+	for _, permissions := range workspaceRolePermissions {
+		if permissions.Include(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkspaceRoleGrants() reports whether members with the role may use the permission code
+func WorkspaceRoleGrants(role, code string) bool {
+	return workspaceRolePermissions[role].Include(code)
+}
+
+// WorkspaceRoleAtLeast() reports whether the role is the minimum role or a more privileged one
+func WorkspaceRoleAtLeast(role, minimum string) bool {
+	return workspaceRoleRank[role] >= workspaceRoleRank[minimum]
+}
+
+// Define the Workspace type, a team that shares references
+type Workspace struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+// Define the WorkspaceMember type
+type WorkspaceMember struct {
+	WorkspaceID int64     `json:"workspace_id"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ValidateWorkspace() validates the workspace input
+func ValidateWorkspace(v *validator.Validator, workspace *Workspace) {
+	v.Check(workspace.Name != "", "name", "must be provided")
+	v.Check(len(workspace.Name) <= 200, "name", "must not be more than 200 characters long")
+}
+
+// ValidateWorkspaceRole() checks the role is one a member can hold
+func ValidateWorkspaceRole(v *validator.Validator, role string) {
+	v.Check(role != "", "role", "must be provided")
+	v.Check(validator.In(role, WorkspaceViewer, WorkspaceEditor, WorkspaceOwner), "role", "must be one of viewer, editor or owner")
+}
+
+// Define the Workspace model
+type WorkspaceModel struct {
+	DB *sql.DB
+}
+
+// Insert() creates the workspace and makes the user its owner
+func (m WorkspaceModel) Insert(workspace *Workspace, ownerID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		insert into workspaces (name)
+		values ($1)
+		returning id, created_at, version
+	`
+	err = tx.QueryRowContext(ctx, query, workspace.Name).Scan(&workspace.ID, &workspace.CreatedAt, &workspace.Version)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		insert into workspace_members (workspace_id, user_id, role)
+		values ($1, $2, $3)
+	`
+	_, err = tx.ExecContext(ctx, query, workspace.ID, ownerID, WorkspaceOwner)
+	if err != nil {
+		return err
+	}
+	workspace.Role = WorkspaceOwner
+
+	return tx.Commit()
+}
+
+// Get() returns the workspace as seen by one of its members
+func (m WorkspaceModel) Get(id, userID int64) (*Workspace, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		select workspaces.id, workspaces.created_at, workspaces.name, workspace_members.role, workspaces.version
+		from workspaces
+		inner join workspace_members on workspace_members.workspace_id = workspaces.id
+		where workspaces.id = $1 and workspace_members.user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var workspace Workspace
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&workspace.ID,
+		&workspace.CreatedAt,
+		&workspace.Name,
+		&workspace.Role,
+		&workspace.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &workspace, nil
+}
+
+// GetAllForUser() returns every workspace the user is a member of together with their role
+func (m WorkspaceModel) GetAllForUser(userID int64) ([]*Workspace, error) {
+	query := `
+		select workspaces.id, workspaces.created_at, workspaces.name, workspace_members.role, workspaces.version
+		from workspaces
+		inner join workspace_members on workspace_members.workspace_id = workspaces.id
+		where workspace_members.user_id = $1
+		order by workspaces.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []*Workspace{}
+	for rows.Next() {
+		var workspace Workspace
+		err := rows.Scan(
+			&workspace.ID,
+			&workspace.CreatedAt,
+			&workspace.Name,
+			&workspace.Role,
+			&workspace.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, &workspace)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// Update() renames the workspace
+func (m WorkspaceModel) Update(workspace *Workspace) error {
+	query := `
+		update workspaces
+		set name = $1, version = version + 1
+		where id = $2 and version = $3
+		returning version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, workspace.Name, workspace.ID, workspace.Version).Scan(&workspace.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes the workspace together with its members and references
+func (m WorkspaceModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		delete from workspaces
+		where id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetRole() returns the user's role in the workspace, ErrRecordNotFound if they are not a member
+func (m WorkspaceModel) GetRole(workspaceID, userID int64) (string, error) {
+	query := `
+		select role
+		from workspace_members
+		where workspace_id = $1 and user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+	err := m.DB.QueryRowContext(ctx, query, workspaceID, userID).Scan(&role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return role, nil
+}
+
+// GetMembers() returns the members of the workspace
+func (m WorkspaceModel) GetMembers(workspaceID int64) ([]*WorkspaceMember, error) {
+	query := `
+		select workspace_members.workspace_id, users.id, users.name, users.email, workspace_members.role, workspace_members.created_at
+		from workspace_members
+		inner join users on users.id = workspace_members.user_id
+		where workspace_members.workspace_id = $1
+		order by users.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*WorkspaceMember{}
+	for rows.Next() {
+		var member WorkspaceMember
+		err := rows.Scan(
+			&member.WorkspaceID,
+			&member.UserID,
+			&member.Name,
+			&member.Email,
+			&member.Role,
+			&member.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SetMember() adds the user to the workspace or changes their role.
+// Demoting the last owner returns ErrLastOwner
+func (m WorkspaceModel) SetMember(workspaceID, userID int64, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		insert into workspace_members (workspace_id, user_id, role)
+		values ($1, $2, $3)
+		on conflict (workspace_id, user_id) do update set role = excluded.role
+	`
+	_, err = tx.ExecContext(ctx, query, workspaceID, userID, role)
+	if err != nil {
+		return err
+	}
+
+	err = ensureOwner(ctx, tx, workspaceID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveMember() takes the user out of the workspace.
+// Removing the last owner returns ErrLastOwner
+func (m WorkspaceModel) RemoveMember(workspaceID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		delete from workspace_members
+		where workspace_id = $1 and user_id = $2
+	`
+	result, err := tx.ExecContext(ctx, query, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = ensureOwner(ctx, tx, workspaceID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureOwner() fails with ErrLastOwner if a change inside the transaction left the workspace without an owner
+func ensureOwner(ctx context.Context, tx *sql.Tx, workspaceID int64) error {
+	query := `
+		select count(*)
+		from workspace_members
+		where workspace_id = $1 and role = $2
+	`
+	var owners int
+	err := tx.QueryRowContext(ctx, query, workspaceID, WorkspaceOwner).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
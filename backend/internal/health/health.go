@@ -0,0 +1,148 @@
+// Filename: MyReference/backend/internal/health/health.go
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check is one named dependency the service relies on. A failing critical check makes the service
+// unready, other checks are only reported. Run may return a short detail, such as a version, to show
+type Check struct {
+	Name     string
+	Critical bool
+	Timeout  time.Duration
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Detail    string  `json:"detail,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check, Healthy is false when a critical check failed
+type Report struct {
+	Healthy bool     `json:"healthy"`
+	Checks  []Result `json:"checks"`
+}
+
+// Registry holds the checks run for a readiness probe
+type Registry struct {
+	mu     sync.Mutex
+	checks []Check
+}
+
+// NewRegistry() creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register() adds checks, a check without a timeout is given 2 seconds
+func (r *Registry) Register(checks ...Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, check := range checks {
+		if check.Timeout <= 0 {
+			check.Timeout = 2 * time.Second
+		}
+		r.checks = append(r.checks, check)
+	}
+}
+
+// Run() runs every check at the same time and waits for them, results are sorted by name
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.Lock()
+	checks := append([]Check(nil), r.checks...)
+	r.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	report := Report{Healthy: true, Checks: results}
+	for _, result := range results {
+		if result.Critical && result.Status != "up" {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+// run() runs a check within its timeout. A check that ignores its context is abandoned when the
+// timeout passes and reported as down
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		detail, err := check.Run(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = ctx.Err()
+	}
+
+	result := Result{
+		Name:      check.Name,
+		Status:    "up",
+		Critical:  check.Critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:    out.detail,
+	}
+	if out.err != nil {
+		result.Status = "down"
+		result.Error = out.err.Error()
+	}
+	return result
+}
+
+// Cached() wraps a check's Run so its outcome, failures included, is reused for ttl. It is meant for
+// checks too costly to run on every probe, such as dialling a remote server
+func Cached(ttl time.Duration, run func(ctx context.Context) (string, error)) func(ctx context.Context) (string, error) {
+	var (
+		mu      sync.Mutex
+		expires time.Time
+		detail  string
+		err     error
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		if time.Now().Before(expires) {
+			defer mu.Unlock()
+			return detail, err
+		}
+		mu.Unlock()
+
+		d, e := run(ctx)
+
+		mu.Lock()
+		defer mu.Unlock()
+		detail, err, expires = d, e, time.Now().Add(ttl)
+		return d, e
+	}
+}
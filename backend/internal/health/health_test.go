@@ -0,0 +1,34 @@
+// Filename: MyReference/backend/internal/health/health_test.go
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	calls := 0
+	failure := errors.New("connection refused")
+	run := Cached(50*time.Millisecond, func(ctx context.Context) (string, error) {
+		calls++
+		return "", failure
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := run(context.Background())
+		if !errors.Is(err, failure) {
+			t.Fatalf("got error %v; want %v", err, failure)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("got %d runs within the interval; want 1", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	run(context.Background())
+	if calls != 2 {
+		t.Errorf("got %d runs after the interval; want 2", calls)
+	}
+}
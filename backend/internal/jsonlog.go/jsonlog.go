@@ -4,10 +4,13 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,10 +39,27 @@ func (l Level) String() string {
 	}
 }
 
+// ParseLevel() turns a level name such as "error" into a Level, "off" silences the logger
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	case "off":
+		return LevelOff, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
 // Define a custom logger
 type Logger struct {
-	out      io.Writer
-	minLevel Level
+	out io.Writer
+	//minLevel holds a Level, it is read and written atomically so it can change while logging
+	minLevel int32
 	mu       sync.Mutex
 }
 
@@ -47,14 +67,34 @@ type Logger struct {
 func New(out io.Writer, minLevel Level) *Logger {
 	return &Logger{
 		out:      out,
-		minLevel: minLevel,
+		minLevel: int32(minLevel),
 	}
 }
 
+// SetLevel() changes the minimum severity that is written
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.minLevel, int32(level))
+}
+
+// Level() returns the minimum severity that is written
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.minLevel))
+}
+
 // Helper methods
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
 	l.print(LevelInfo, message, properties)
 }
+
+// PrintNotice() writes an INFO entry whatever the minimum level, unless logging is off. It is for
+// the few operational events that must be seen, such as a configuration reload
+func (l *Logger) PrintNotice(message string, properties map[string]string) {
+	if l.Level() == LevelOff {
+		return
+	}
+	l.write(LevelInfo, message, properties)
+}
+
 func (l *Logger) PrintError(err error, properties map[string]string) {
 	l.print(LevelError, err.Error(), properties)
 }
@@ -65,9 +105,14 @@ func (l *Logger) PrintFatal(err error, properties map[string]string) {
 
 func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
 	//Ensure severity level is at least minimal
-	if level < l.minLevel {
+	if level < l.Level() {
 		return 0, nil
 	}
+	return l.write(level, message, properties)
+}
+
+// write() writes the entry without looking at the minimum level
+func (l *Logger) write(level Level, message string, properties map[string]string) (int, error) {
 
 	//Create a struct for holding the log entry data
 	data := struct {
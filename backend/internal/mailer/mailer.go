@@ -3,8 +3,11 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"html/template"
+	"net"
+	"strconv"
 	"time"
 
 	"gopkg.in/mail.v2"
@@ -30,6 +33,16 @@ func New(host string, port int, username, password, sender string) Mailer {
 	}
 }
 
+// Ping() checks the SMTP server accepts connections, without logging in or sending anything
+func (m Mailer) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.dailer.Host, strconv.Itoa(m.dailer.Port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 // Send a mail
 func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
 	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
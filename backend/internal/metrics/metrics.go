@@ -0,0 +1,267 @@
+// Filename: MyReference/backend/internal/metrics/metrics.go
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format written by Registry.Write()
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// A Collector writes its metrics in the Prometheus text format
+type Collector interface {
+	Collect(w io.Writer)
+}
+
+// Registry holds the collectors exposed on the metrics endpoint
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry() creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register() adds collectors, they are written in the order they were registered
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// Write() writes every metric
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := r.collectors
+	r.mu.Unlock()
+
+	for _, collector := range collectors {
+		collector.Collect(w)
+	}
+}
+
+// series is one combination of label values
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// vec is the shared part of metrics that are split up by labels
+type vec struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, kind string, labels []string, buckets []float64) *vec {
+	return &vec{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+}
+
+// with() returns the series for the label values, the lock must be held
+func (v *vec) with(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, found := v.series[key]
+	if !found {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if v.buckets != nil {
+			s.counts = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// Collect() writes the series sorted by their label values
+func (v *vec) Collect(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	writeHeader(w, v.name, v.help, v.kind)
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := v.series[key]
+		if v.kind != "histogram" {
+			writeSample(w, v.name, v.labels, s.labelValues, "", "", s.value)
+			continue
+		}
+		for i, bound := range v.buckets {
+			writeSample(w, v.name+"_bucket", v.labels, s.labelValues, "le", formatFloat(bound), float64(s.counts[i]))
+		}
+		writeSample(w, v.name+"_bucket", v.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(w, v.name+"_sum", v.labels, s.labelValues, "", "", s.sum)
+		writeSample(w, v.name+"_count", v.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+// CounterVec is a counter split up by labels
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec() creates a counter with the label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labels, nil)}
+}
+
+// Inc() adds one to the series for the label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add() adds a positive amount to the series for the label values
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counters can only go up")
+	}
+	c.mu.Lock()
+	c.with(labelValues).value += delta
+	c.mu.Unlock()
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	*vec
+}
+
+// NewGauge() creates a gauge without labels
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{newVec(name, help, "gauge", nil, nil)}
+	g.with(nil)
+	return g
+}
+
+// Add() changes the gauge by delta
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	g.with(nil).value += delta
+	g.mu.Unlock()
+}
+
+// Inc() adds one to the gauge
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec() takes one from the gauge
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// HistogramVec counts observations into buckets, split up by labels
+type HistogramVec struct {
+	*vec
+}
+
+// DefaultBuckets suit request durations in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// NewHistogramVec() creates a histogram with the bucket upper bounds, which must be sorted
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{newVec(name, help, "histogram", labels, buckets)}
+}
+
+// Observe() records a value in the series for the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.with(labelValues)
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// funcCollector reads its value when the metrics are collected
+type funcCollector struct {
+	name string
+	help string
+	kind string
+	fn   func() float64
+}
+
+// NewGaugeFunc() creates a gauge whose value is read from fn on every scrape
+func NewGaugeFunc(name, help string, fn func() float64) Collector {
+	return funcCollector{name: name, help: help, kind: "gauge", fn: fn}
+}
+
+// NewCounterFunc() creates a counter whose value is read from fn on every scrape
+func NewCounterFunc(name, help string, fn func() float64) Collector {
+	return funcCollector{name: name, help: help, kind: "counter", fn: fn}
+}
+
+func (f funcCollector) Collect(w io.Writer) {
+	writeHeader(w, f.name, f.help, f.kind)
+	writeSample(w, f.name, nil, nil, "", "", f.fn())
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample() writes one line, extraName and extraValue add a label such as a histogram's le
+func writeSample(w io.Writer, name string, labels, labelValues []string, extraName, extraValue string, value float64) {
+	var pairs []string
+	for i, label := range labels {
+		pairs = append(pairs, label+`="`+escapeLabel(labelValues[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) > 0 {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
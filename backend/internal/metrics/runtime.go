@@ -0,0 +1,44 @@
+// Filename: MyReference/backend/internal/metrics/runtime.go
+package metrics
+
+import (
+	"io"
+	"runtime"
+	"time"
+)
+
+// runtimeCollector reports on the Go runtime, reading the memory statistics once per scrape
+type runtimeCollector struct {
+	start time.Time
+}
+
+// NewRuntimeCollector() creates a collector of goroutine, memory and garbage collector metrics
+func NewRuntimeCollector() Collector {
+	return runtimeCollector{start: time.Now()}
+}
+
+func (c runtimeCollector) Collect(w io.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	samples := []struct {
+		name  string
+		help  string
+		kind  string
+		value float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine())},
+		{"go_gomaxprocs", "Number of OS threads that can execute Go code at once.", "gauge", float64(runtime.GOMAXPROCS(0))},
+		{"go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge", float64(stats.Alloc)},
+		{"go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", "counter", float64(stats.TotalAlloc)},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from the system.", "gauge", float64(stats.Sys)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", "gauge", float64(stats.HeapObjects)},
+		{"go_gc_cycles_total", "Number of completed garbage collection cycles.", "counter", float64(stats.NumGC)},
+		{"go_gc_pause_seconds_total", "Total time the garbage collector has stopped the program.", "counter", float64(stats.PauseTotalNs) / 1e9},
+		{"process_uptime_seconds", "Time since the process started.", "gauge", time.Since(c.start).Seconds()},
+	}
+	for _, s := range samples {
+		writeHeader(w, s.name, s.help, s.kind)
+		writeSample(w, s.name, nil, nil, "", "", s.value)
+	}
+}
@@ -0,0 +1,332 @@
+// Filename: MyReference/backend/internal/migrate/migrate.go
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// NilVersion is the version of a database no migration has been applied to
+const NilVersion int64 = -1
+
+var (
+	ErrDirty        = errors.New("migrate: a migration failed part way, fix the schema and force the version")
+	ErrNoMigrations = errors.New("migrate: no migrations found")
+	ErrNoChange     = errors.New("migrate: no change")
+)
+
+// Migration is one numbered change to the schema with the SQL to apply and undo it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes one migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Migrator applies migrations, keeping the version in a schema_migrations table laid out the way
+// golang-migrate keeps it, so databases migrated with the migrate tool carry on where they were
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+var filename = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// New() reads the migrations in the root of fsys, files are named like 000001_create_users.up.sql
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := filename.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d has two names, %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	if len(byVersion) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	migrator := &Migrator{db: db}
+	for _, m := range byVersion {
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+	return migrator, nil
+}
+
+// Latest() is the version of the newest migration, the one this build of the code expects
+func (m *Migrator) Latest() int64 {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version() returns the version the database is at and whether the last migration failed part way
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	return version(ctx, m.db)
+}
+
+// Status() lists every migration and whether the database has it
+func (m *Migrator) Status(ctx context.Context) ([]Status, int64, bool, error) {
+	current, dirty, err := m.Version(ctx)
+	if err != nil {
+		return nil, current, dirty, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{Migration: migration, Applied: migration.Version <= current})
+	}
+	return statuses, current, dirty, nil
+}
+
+// Check() returns an error unless the database is at exactly the latest version
+func (m *Migrator) Check(ctx context.Context) error {
+	current, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case dirty:
+		return fmt.Errorf("%w (version %d)", ErrDirty, current)
+	case current < m.Latest():
+		return fmt.Errorf("migrate: database schema is at version %d, version %d is required, run the migrate up command", current, m.Latest())
+	case current > m.Latest():
+		return fmt.Errorf("migrate: database schema is at version %d, which is newer than version %d this build supports", current, m.Latest())
+	}
+	return nil
+}
+
+// Up() applies every migration not yet applied
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down() undoes the most recent migration
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, dirty, err := version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w (version %d)", ErrDirty, current)
+		}
+		if current == NilVersion {
+			return ErrNoChange
+		}
+		return m.migrate(ctx, conn, current, m.previous(current))
+	})
+}
+
+// Goto() migrates up or down to the version, which must be one of the migrations or 0 to undo them all
+func (m *Migrator) Goto(ctx context.Context, target int64) error {
+	if target == 0 {
+		target = NilVersion
+	}
+	if target != NilVersion && m.find(target) < 0 {
+		return fmt.Errorf("migrate: there is no migration with version %d", target)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, dirty, err := version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w (version %d)", ErrDirty, current)
+		}
+		if current == target {
+			return ErrNoChange
+		}
+		return m.migrate(ctx, conn, current, target)
+	})
+}
+
+// Force() records the version without running anything, used to clear the dirty flag after a
+// failed migration has been cleaned up by hand
+func (m *Migrator) Force(ctx context.Context, target int64) error {
+	if target == 0 {
+		target = NilVersion
+	}
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return setVersion(ctx, conn, target, false)
+	})
+}
+
+// migrate() steps one migration at a time from the current version to the target. Each version
+// is recorded as dirty while its SQL runs, so a failure part way is noticed
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current, target int64) error {
+	if current != NilVersion && m.find(current) < 0 {
+		return fmt.Errorf("migrate: database schema is at version %d, which this build has no migration for", current)
+	}
+
+	for current < target {
+		next := m.migrations[m.find(m.next(current))]
+		err := setVersion(ctx, conn, next.Version, true)
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecContext(ctx, next.Up)
+		if err != nil {
+			return fmt.Errorf("migrate: %d_%s up: %w", next.Version, next.Name, err)
+		}
+		err = setVersion(ctx, conn, next.Version, false)
+		if err != nil {
+			return err
+		}
+		current = next.Version
+	}
+
+	for current > target {
+		migration := m.migrations[m.find(current)]
+		previous := m.previous(current)
+		err := setVersion(ctx, conn, previous, true)
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecContext(ctx, migration.Down)
+		if err != nil {
+			return fmt.Errorf("migrate: %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		err = setVersion(ctx, conn, previous, false)
+		if err != nil {
+			return err
+		}
+		current = previous
+	}
+	return nil
+}
+
+// find() returns the index of the migration with the version, -1 if there is none
+func (m *Migrator) find(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// next() returns the version after current
+func (m *Migrator) next(current int64) int64 {
+	for _, migration := range m.migrations {
+		if migration.Version > current {
+			return migration.Version
+		}
+	}
+	return current
+}
+
+// previous() returns the version before current, NilVersion before the first
+func (m *Migrator) previous(current int64) int64 {
+	previous := NilVersion
+	for _, migration := range m.migrations {
+		if migration.Version >= current {
+			break
+		}
+		previous = migration.Version
+	}
+	return previous
+}
+
+// withLock() runs fn on one connection holding a Postgres advisory lock, so replicas starting
+// together take turns and the second finds the work already done
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext(current_database() || '.schema_migrations'))`)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext(current_database() || '.schema_migrations'))`)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// version() reads the schema_migrations table, a missing table or row means nothing was applied
+func version(ctx context.Context, q queryer) (int64, bool, error) {
+	var exists bool
+	err := q.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return NilVersion, false, err
+	}
+
+	var version int64
+	var dirty bool
+	err = q.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NilVersion, false, nil
+	}
+	return version, dirty, err
+}
+
+// setVersion() replaces the recorded version, the table holds a single row
+func setVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `TRUNCATE schema_migrations`)
+	if err != nil {
+		return err
+	}
+	if version != NilVersion || dirty {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
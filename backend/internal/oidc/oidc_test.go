@@ -0,0 +1,196 @@
+// Filename: MyReference/backend/internal/oidc/oidc_test.go
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"mgomez.net/internal/oidc/oidctest"
+)
+
+const (
+	testClientID    = "myreference"
+	testSecret      = "secret"
+	testRedirectURL = "http://localhost:4000/v1/oidc/callback"
+)
+
+// startProvider() runs the mock identity provider until the test ends and discovers it
+func startProvider(t *testing.T) *Provider {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(nil)
+	issuer := "http://" + srv.Listener.Addr().String()
+	mock, err := oidctest.NewProvider(issuer, testClientID, testSecret, testRedirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Config.Handler = mock
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	provider, err := Discover(context.Background(), issuer, testClientID, testSecret, testRedirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// signIn() does what the browser does: opens the sign in page, submits it and follows the
+// redirect back to the API as far as reading the code and state off it
+func signIn(t *testing.T, authURL, email string, verified bool) (code, state string) {
+	t.Helper()
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("sign in page: got status %d; want %d", res.StatusCode, http.StatusOK)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := u.Query()
+	form.Set("email", email)
+	form.Set("name", "Test User")
+	if verified {
+		form.Set("email_verified", "true")
+	}
+	u.RawQuery = ""
+	res, err = client.PostForm(u.String(), form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("sign in: got status %d; want %d", res.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURL+"?") {
+		t.Fatalf("got redirect to %q; want the API callback", location)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestLogin(t *testing.T) {
+	provider := startProvider(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		email    string
+		verified bool
+	}{
+		{"verified email", "alice@example.com", true},
+		{"unverified email", "bob@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, nonce, verifier := "state-"+tt.email, "nonce-"+tt.email, "verifier-"+tt.email
+			code, returnedState := signIn(t, provider.AuthCodeURL(state, nonce, verifier), tt.email, tt.verified)
+			if returnedState != state {
+				t.Errorf("got state %q; want %q", returnedState, state)
+			}
+
+			raw, err := provider.Exchange(ctx, code, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := provider.VerifyIDToken(ctx, raw, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Issuer != provider.Issuer || claims.Subject == "" {
+				t.Errorf("got issuer %q subject %q; want %q and a subject", claims.Issuer, claims.Subject, provider.Issuer)
+			}
+			if claims.Email != tt.email || claims.EmailVerified != tt.verified {
+				t.Errorf("got email %q verified %t; want %q verified %t", claims.Email, claims.EmailVerified, tt.email, tt.verified)
+			}
+		})
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	provider := startProvider(t)
+	ctx := context.Background()
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		code, _ := signIn(t, provider.AuthCodeURL("state", "nonce", "verifier"), "alice@example.com", true)
+		_, err := provider.Exchange(ctx, code, "another-verifier")
+		if err == nil {
+			t.Error("got no error; want the code to be refused")
+		}
+	})
+
+	t.Run("code used twice", func(t *testing.T) {
+		code, _ := signIn(t, provider.AuthCodeURL("state", "nonce", "verifier"), "alice@example.com", true)
+		_, err := provider.Exchange(ctx, code, "verifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = provider.Exchange(ctx, code, "verifier")
+		if err == nil {
+			t.Error("got no error; want the code to be refused")
+		}
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		code, _ := signIn(t, provider.AuthCodeURL("state", "nonce", "verifier"), "alice@example.com", true)
+		raw, err := provider.Exchange(ctx, code, "verifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = provider.VerifyIDToken(ctx, raw, "another-nonce")
+		if !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("got error %v; want %v", err, ErrInvalidIDToken)
+		}
+	})
+
+	t.Run("tampered token", func(t *testing.T) {
+		code, _ := signIn(t, provider.AuthCodeURL("state", "nonce", "verifier"), "alice@example.com", true)
+		raw, err := provider.Exchange(ctx, code, "verifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, _ := signIn(t, provider.AuthCodeURL("state", "nonce", "verifier"), "mallory@example.com", true)
+		rawOther, err := provider.Exchange(ctx, other, "verifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		//the claims of one token with the signature of another
+		parts, otherParts := strings.Split(raw, "."), strings.Split(rawOther, ".")
+		_, err = provider.VerifyIDToken(ctx, parts[0]+"."+otherParts[1]+"."+parts[2], "nonce")
+		if !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("got error %v; want %v", err, ErrInvalidIDToken)
+		}
+	})
+
+	t.Run("other issuer", func(t *testing.T) {
+		other := startProvider(t)
+		code, _ := signIn(t, other.AuthCodeURL("state", "nonce", "verifier"), "alice@example.com", true)
+		raw, err := other.Exchange(ctx, code, "verifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = provider.VerifyIDToken(ctx, raw, "nonce")
+		if err == nil {
+			t.Error("got no error; want a token from another provider to be refused")
+		}
+	})
+}
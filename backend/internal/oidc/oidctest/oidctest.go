@@ -0,0 +1,267 @@
+// Filename: MyReference/backend/internal/oidc/oidctest/oidctest.go
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const signInPage = `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+	</head>
+	<body>
+		<h1>Mock identity provider</h1>
+		<form method="POST" action="/authorize">
+			<input type="hidden" name="client_id" value="{{.ClientID}}">
+			<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+			<input type="hidden" name="state" value="{{.State}}">
+			<input type="hidden" name="nonce" value="{{.Nonce}}">
+			<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+			<p><label>Email <input type="email" name="email" required></label></p>
+			<p><label>Name <input type="text" name="name"></label></p>
+			<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+			<p><button type="submit">Sign in</button></p>
+		</form>
+	</body>
+	</html>
+`
+
+const keyID = "demo"
+
+// What the provider remembers about an issued authorization code
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	email         string
+	name          string
+	verified      bool
+	expiry        time.Time
+}
+
+// Provider is a mock OpenID Connect identity provider. Anyone can sign in as any email address,
+// so never point a real deployment at it
+type Provider struct {
+	issuer      string
+	clientID    string
+	secret      string
+	redirectURI string
+	key         *rsa.PrivateKey
+	page        *template.Template
+
+	mu    sync.Mutex
+	codes map[string]authorization
+	mux   *http.ServeMux
+}
+
+// NewProvider() creates a provider for one client, signing ID tokens with a fresh key
+func NewProvider(issuer, clientID, secret, redirectURI string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		issuer:      issuer,
+		clientID:    clientID,
+		secret:      secret,
+		redirectURI: redirectURI,
+		key:         key,
+		page:        template.Must(template.New("page").Parse(signInPage)),
+		codes:       make(map[string]authorization),
+		mux:         http.NewServeMux(),
+	}
+	p.mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	p.mux.HandleFunc("/jwks", p.jwks)
+	p.mux.HandleFunc("/authorize", p.authorize)
+	p.mux.HandleFunc("/token", p.token)
+	return p, nil
+}
+
+// ServeHTTP() answers the discovery, key, authorization and token endpoints
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	e := big.NewInt(int64(p.key.PublicKey.E)).Bytes()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(e),
+		}},
+	})
+}
+
+// authorize() shows the sign in form, and when it is submitted sends the browser back with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("client_id") != p.clientID || r.Form.Get("redirect_uri") != p.redirectURI {
+		http.Error(w, "unknown client or redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if r.Form.Get("response_type") != "code" || r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "" {
+			http.Error(w, "only the authorization code flow with S256 PKCE is supported", http.StatusBadRequest)
+			return
+		}
+		p.page.Execute(w, map[string]string{
+			"ClientID":      p.clientID,
+			"RedirectURI":   p.redirectURI,
+			"State":         r.Form.Get("state"),
+			"Nonce":         r.Form.Get("nonce"),
+			"CodeChallenge": r.Form.Get("code_challenge"),
+		})
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		clientID:      p.clientID,
+		redirectURI:   p.redirectURI,
+		nonce:         r.Form.Get("nonce"),
+		codeChallenge: r.Form.Get("code_challenge"),
+		email:         r.Form.Get("email"),
+		name:          r.Form.Get("name"),
+		verified:      r.Form.Get("email_verified") == "true",
+		expiry:        time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	values := url.Values{}
+	values.Set("code", code)
+	values.Set("state", r.Form.Get("state"))
+	http.Redirect(w, r, p.redirectURI+"?"+values.Encode(), http.StatusFound)
+}
+
+// token() exchanges a code for a signed ID token once the client and the PKCE verifier check out
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil || r.Method != http.MethodPost || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(p.secret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	//codes can only be used once
+	p.mu.Lock()
+	auth, found := p.codes[r.Form.Get("code")]
+	delete(p.codes, r.Form.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if !found || time.Now().After(auth.expiry) || auth.redirectURI != r.Form.Get("redirect_uri") || challenge != auth.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	//the subject must stay the same for an account, so derive it from the email address
+	subject := sha256.Sum256([]byte(auth.email))
+	now := time.Now()
+	idToken, err := p.sign(map[string]interface{}{
+		"iss":            p.issuer,
+		"sub":            hex.EncodeToString(subject[:16]),
+		"aud":            auth.clientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.email,
+		"email_verified": auth.verified,
+		"name":           auth.name,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// sign() creates an RS256 JWT
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,70 @@
+// Filename: MyReference/backend/internal/ratelimit/memory.go
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Memory is a token bucket limiter kept in the process, every replica has its own budgets
+type Memory struct {
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemory() creates the limiter and a background goroutine that forgets idle clients
+func NewMemory() *Memory {
+	m := &Memory{clients: make(map[string]*client)}
+
+	//remove old entries from the clients map once every minute
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			m.mu.Lock()
+			for key, client := range m.clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(m.clients, key)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}()
+	return m
+}
+
+// Allow() takes a token from the key's bucket
+func (m *Memory) Allow(ctx context.Context, policy Policy, key string) (Result, error) {
+	key = policy.Name + ":" + key
+
+	m.mu.Lock()
+	c, found := m.clients[key]
+	if !found {
+		c = &client{limiter: rate.NewLimiter(rate.Limit(policy.RPS), policy.Burst)}
+		m.clients[key] = c
+	}
+	c.lastSeen = time.Now()
+	allowed := c.limiter.Allow()
+	tokens := c.limiter.Tokens()
+	m.mu.Unlock()
+
+	result := Result{
+		Allowed: allowed,
+		Limit:   policy.Burst,
+		Reset:   durationFor(float64(policy.Burst)-tokens, policy.RPS),
+	}
+	if tokens > 0 {
+		result.Remaining = int(tokens)
+	}
+	if !allowed {
+		result.RetryAfter = durationFor(1-tokens, policy.RPS)
+	}
+	return result, nil
+}
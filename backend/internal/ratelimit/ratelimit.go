@@ -0,0 +1,39 @@
+// Filename: MyReference/backend/internal/ratelimit/ratelimit.go
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy is the request budget for a group of routes: RPS requests a second on average
+// with bursts of up to Burst requests
+type Policy struct {
+	Name  string
+	RPS   float64
+	Burst int
+}
+
+// Result tells the caller whether the request may go ahead and what is left of the budget
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// A Limiter keeps a budget for every key under each policy
+type Limiter interface {
+	//Allow() spends one request of the key's budget
+	Allow(ctx context.Context, policy Policy, key string) (Result, error)
+}
+
+// durationFor() returns how long it takes to earn back the requests at the policy's rate
+func durationFor(requests, rps float64) time.Duration {
+	if requests <= 0 || rps <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(requests / rps * float64(time.Second)))
+}
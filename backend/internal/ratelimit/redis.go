@@ -0,0 +1,280 @@
+// Filename: MyReference/backend/internal/ratelimit/redis.go
+package ratelimit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrProtocol = errors.New("redis: protocol error")
+)
+
+// Error is an error reply sent by the Redis server
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Redis is a sliding window limiter kept in a Redis compatible server, so every replica
+// of the API spends from the same budget. Each key counts the requests in fixed windows and
+// the previous window is weighted by how much of it still overlaps the sliding window
+type Redis struct {
+	addr     string
+	password string
+	timeout  time.Duration
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedis() creates the limiter, connections are opened when needed and up to poolSize kept open
+func NewRedis(addr, password string, timeout time.Duration, poolSize int) *Redis {
+	return &Redis{
+		addr:     addr,
+		password: password,
+		timeout:  timeout,
+		pool:     make(chan *redisConn, poolSize),
+	}
+}
+
+// Allow() counts the request in the key's current window. The policy allows Burst requests
+// in a window of Burst/RPS seconds. Rejected requests are counted too, so a client that keeps
+// retrying stays limited
+func (l *Redis) Allow(ctx context.Context, policy Policy, key string) (Result, error) {
+	window := durationFor(float64(policy.Burst), policy.RPS)
+	if window < time.Millisecond {
+		window = time.Millisecond
+	}
+	now := time.Now().UnixNano()
+	index := now / int64(window)
+	elapsed := time.Duration(now % int64(window))
+
+	prefix := "ratelimit:" + policy.Name + ":" + key + ":"
+	current := prefix + strconv.FormatInt(index, 10)
+	previous := prefix + strconv.FormatInt(index-1, 10)
+
+	//one round trip: count the request, keep the window until the next one is over, read the last one
+	replies, err := l.pipeline(ctx,
+		[]string{"INCR", current},
+		[]string{"PEXPIRE", current, strconv.FormatInt(int64(2*window/time.Millisecond), 10)},
+		[]string{"GET", previous},
+	)
+	if err != nil {
+		return Result{}, err
+	}
+	count, ok := replies[0].(int64)
+	if !ok {
+		return Result{}, ErrProtocol
+	}
+	var last int64
+	if s, ok := replies[2].(string); ok {
+		last, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return Result{}, ErrProtocol
+		}
+	}
+
+	used := float64(last)*(1-float64(elapsed)/float64(window)) + float64(count)
+	result := Result{
+		Allowed: used <= float64(policy.Burst),
+		Limit:   policy.Burst,
+		Reset:   window - elapsed,
+	}
+	if remaining := policy.Burst - int(math.Ceil(used)); remaining > 0 {
+		result.Remaining = remaining
+	}
+	if !result.Allowed {
+		result.RetryAfter = retryAfter(last, count, policy.Burst, window, elapsed)
+	}
+	return result, nil
+}
+
+// retryAfter() works out when the weighted count has fallen far enough for one more request
+func retryAfter(last, count int64, limit int, window, elapsed time.Duration) time.Duration {
+	room := float64(limit - 1)
+	if float64(count) <= room && last > 0 {
+		//the previous window's share shrinks as this window goes on
+		at := time.Duration(float64(window) * (1 - (room-float64(count))/float64(last)))
+		return at - elapsed
+	}
+	//otherwise it takes part of the next window for this one's count to shrink
+	at := time.Duration(float64(window) * (1 - room/float64(count)))
+	return window - elapsed + at
+}
+
+// Ping() checks the server can be reached
+func (l *Redis) Ping(ctx context.Context) error {
+	replies, err := l.pipeline(ctx, []string{"PING"})
+	if err != nil {
+		return err
+	}
+	if replies[0] != "PONG" {
+		return ErrProtocol
+	}
+	return nil
+}
+
+// pipeline() sends the commands together and reads their replies in order
+func (l *Redis) pipeline(ctx context.Context, commands ...[]string) ([]interface{}, error) {
+	c, err := l.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(l.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+
+	var buf bytes.Buffer
+	for _, command := range commands {
+		writeCommand(&buf, command)
+	}
+	_, err = c.conn.Write(buf.Bytes())
+	if err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(commands))
+	for i := range commands {
+		replies[i], err = readReply(c.reader)
+		if err != nil {
+			//the connection is out of step with the server, so it can't be reused
+			c.conn.Close()
+			return nil, err
+		}
+	}
+	l.put(c)
+
+	for _, reply := range replies {
+		if err, ok := reply.(Error); ok {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+// get() takes an idle connection from the pool or dials a new one
+func (l *Redis) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-l.pool:
+		return c, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: l.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", l.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if l.password != "" {
+		conn.SetDeadline(time.Now().Add(l.timeout))
+		var buf bytes.Buffer
+		writeCommand(&buf, []string{"AUTH", l.password})
+		_, err = conn.Write(buf.Bytes())
+		if err == nil {
+			var reply interface{}
+			reply, err = readReply(c.reader)
+			if replyErr, ok := reply.(Error); ok {
+				err = replyErr
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// put() returns a connection to the pool, closing it when the pool is full
+func (l *Redis) put(c *redisConn) {
+	select {
+	case l.pool <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+// writeCommand() encodes a command as a RESP array of bulk strings
+func writeCommand(buf *bytes.Buffer, args []string) {
+	fmt.Fprintf(buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply() decodes one RESP reply. Simple and bulk strings become string, integers int64,
+// arrays []interface{}, missing values nil and error replies Error
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrProtocol
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return Error(payload), nil
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		bulk := make([]byte, n+2)
+		_, err = io.ReadFull(r, bulk)
+		if err != nil {
+			return nil, err
+		}
+		return string(bulk[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		elements := make([]interface{}, n)
+		for i := range elements {
+			elements[i], err = readReply(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return elements, nil
+	default:
+		return nil, ErrProtocol
+	}
+}
@@ -0,0 +1,136 @@
+// Filename: MyReference/backend/internal/ratelimit/redis_test.go
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"mgomez.net/internal/redistest"
+)
+
+// startRedis() runs the in-memory stand-in on a free port until the test ends
+func startRedis(t *testing.T, password string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go redistest.NewServer(password).Serve(listener)
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String()
+}
+
+// A window of Burst/RPS = 30000 seconds, so a test never crosses into the next one
+var testPolicy = Policy{Name: "test", RPS: 0.0001, Burst: 3}
+
+func TestRedisAllow(t *testing.T) {
+	limiter := NewRedis(startRedis(t, ""), "", time.Second, 2)
+	ctx := context.Background()
+
+	for i := 1; i <= testPolicy.Burst; i++ {
+		result, err := limiter.Allow(ctx, testPolicy, "client")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d: got rejected; want allowed", i)
+		}
+		if result.Limit != testPolicy.Burst {
+			t.Errorf("request %d: got limit %d; want %d", i, result.Limit, testPolicy.Burst)
+		}
+		if want := testPolicy.Burst - i; result.Remaining != want {
+			t.Errorf("request %d: got remaining %d; want %d", i, result.Remaining, want)
+		}
+	}
+
+	result, err := limiter.Allow(ctx, testPolicy, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Fatal("got allowed over the burst; want rejected")
+	}
+	if result.RetryAfter <= 0 {
+		t.Errorf("got retry after %s; want a positive duration", result.RetryAfter)
+	}
+
+	//other keys and other policies have their own budget
+	result, err = limiter.Allow(ctx, testPolicy, "other-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed {
+		t.Error("other key: got rejected; want allowed")
+	}
+	other := testPolicy
+	other.Name = "other"
+	result, err = limiter.Allow(ctx, other, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed {
+		t.Error("other policy: got rejected; want allowed")
+	}
+}
+
+func TestRedisSharedBudget(t *testing.T) {
+	addr := startRedis(t, "")
+	replicas := []*Redis{
+		NewRedis(addr, "", time.Second, 2),
+		NewRedis(addr, "", time.Second, 2),
+	}
+	ctx := context.Background()
+
+	allowed := 0
+	for i := 0; i < 2*testPolicy.Burst; i++ {
+		result, err := replicas[i%2].Allow(ctx, testPolicy, "client")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed {
+			allowed++
+		}
+	}
+	if allowed != testPolicy.Burst {
+		t.Errorf("got %d requests allowed across replicas; want %d", allowed, testPolicy.Burst)
+	}
+}
+
+func TestRedisPassword(t *testing.T) {
+	addr := startRedis(t, "secret")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"right password", "secret", false},
+		{"wrong password", "guess", true},
+		{"no password", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewRedis(addr, tt.password, time.Second, 1).Ping(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v; want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = NewRedis(addr, "", 100*time.Millisecond, 1).Allow(context.Background(), testPolicy, "client")
+	if err == nil {
+		t.Error("got no error from an unreachable server; want one")
+	}
+}
@@ -0,0 +1,206 @@
+// Filename: MyReference/backend/internal/redistest/redistest.go
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errProtocol = errors.New("protocol error")
+
+type entry struct {
+	value  string
+	expiry time.Time
+}
+
+// Server is an in-memory stand-in for Redis that understands the few commands the rate limiter sends
+type Server struct {
+	mu       sync.Mutex
+	password string
+	data     map[string]*entry
+}
+
+// NewServer() creates an empty server, clients must send AUTH with the password unless it is empty
+func NewServer(password string) *Server {
+	return &Server{password: password, data: make(map[string]*entry)}
+}
+
+// Serve() answers the connections made to the listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve() answers the commands sent on a connection until it is closed
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	authenticated := s.password == ""
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				fmt.Fprintf(writer, "-ERR %s\r\n", err)
+				writer.Flush()
+			}
+			return
+		}
+
+		command := strings.ToUpper(args[0])
+		switch {
+		case command == "AUTH":
+			if len(args) == 2 && args[1] == s.password {
+				authenticated = true
+				writer.WriteString("+OK\r\n")
+			} else {
+				writer.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			writer.WriteString("-NOAUTH Authentication required.\r\n")
+		default:
+			s.execute(writer, command, args[1:])
+		}
+
+		//answer a pipeline in one write
+		if reader.Buffered() == 0 {
+			err = writer.Flush()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// execute() runs one command and writes its reply
+func (s *Server) execute(w *bufio.Writer, command string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case command == "PING":
+		w.WriteString("+PONG\r\n")
+	case command == "GET" && len(args) == 1:
+		e := s.get(args[0])
+		if e == nil {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(e.value), e.value)
+	case command == "SET" && len(args) == 2:
+		s.data[args[0]] = &entry{value: args[1]}
+		w.WriteString("+OK\r\n")
+	case command == "INCR" && len(args) == 1:
+		e := s.get(args[0])
+		if e == nil {
+			e = &entry{value: "0"}
+			s.data[args[0]] = e
+		}
+		n, err := strconv.ParseInt(e.value, 10, 64)
+		if err != nil {
+			w.WriteString("-ERR value is not an integer or out of range\r\n")
+			return
+		}
+		e.value = strconv.FormatInt(n+1, 10)
+		fmt.Fprintf(w, ":%d\r\n", n+1)
+	case command == "PEXPIRE" && len(args) == 2:
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			w.WriteString("-ERR value is not an integer or out of range\r\n")
+			return
+		}
+		e := s.get(args[0])
+		if e == nil {
+			w.WriteString(":0\r\n")
+			return
+		}
+		e.expiry = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		w.WriteString(":1\r\n")
+	case command == "DEL":
+		deleted := 0
+		for _, key := range args {
+			if s.get(key) != nil {
+				delete(s.data, key)
+				deleted++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	default:
+		fmt.Fprintf(w, "-ERR unknown command or wrong number of arguments for '%s'\r\n", command)
+	}
+}
+
+// get() returns the entry for the key, dropping it if it has expired. The lock must be held
+func (s *Server) get(key string) *entry {
+	e, found := s.data[key]
+	if !found {
+		return nil
+	}
+	if !e.expiry.IsZero() && time.Now().After(e.expiry) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+// readCommand() reads a command sent as a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[0] != '*' {
+		return nil, errProtocol
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, errProtocol
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 2 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errProtocol
+		}
+		bulk := make([]byte, size+2)
+		_, err = io.ReadFull(r, bulk)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = string(bulk[:size])
+	}
+	return args, nil
+}
+
+// readLine() reads a line without its \r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errProtocol
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
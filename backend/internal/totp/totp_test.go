@@ -0,0 +1,103 @@
+// Filename: MyReference/backend/internal/totp/totp_test.go
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// The RFC 6238 appendix B secret, the ASCII string "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	//RFC 6238 appendix B SHA-1 vectors, the codes are the last 6 of the 8 digits given there
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("time %d: got %q; want %q", tt.unix, got, tt.want)
+		}
+	}
+
+	_, err := Code("not base32!", 1)
+	if err != ErrInvalidSecret {
+		t.Errorf("got error %v; want %v", err, ErrInvalidSecret)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name     string
+		offset   int64
+		lastUsed int64
+		valid    bool
+	}{
+		{"current step", 0, 0, true},
+		{"one step behind", -1, 0, true},
+		{"one step ahead", 1, 0, true},
+		{"two steps behind", -2, 0, false},
+		{"two steps ahead", 2, 0, false},
+		{"step already used", 0, current, false},
+		{"earlier step after a later one was used", -1, current, false},
+		{"later step after an earlier one was used", 1, current, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			step, ok := Validate(rfcSecret, code, now, 1, tt.lastUsed)
+			if ok != tt.valid {
+				t.Fatalf("got valid %t; want %t", ok, tt.valid)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("got step %d; want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateReuse(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(rfcSecret, " "+code+" ", now, 1, 0)
+	if !ok {
+		t.Fatal("got the first use rejected; want it accepted")
+	}
+	//the caller records the step, after which the same code is refused for the rest of its window
+	for _, later := range []time.Time{now, now.Add(Period * time.Second)} {
+		if _, ok := Validate(rfcSecret, code, later, 1, step); ok {
+			t.Errorf("at %s: got the reused code accepted; want it rejected", later)
+		}
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now, 1, 0); ok {
+			t.Errorf("got %q accepted; want it rejected", code)
+		}
+	}
+}
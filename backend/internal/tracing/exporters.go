@@ -0,0 +1,172 @@
+// Filename: MyReference/backend/internal/tracing/exporters.go
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StdoutExporter writes each span as a line of JSON, useful in development and tests
+type StdoutExporter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewStdoutExporter() creates an exporter writing to out
+func NewStdoutExporter(out io.Writer) *StdoutExporter {
+	return &StdoutExporter{out: out}
+}
+
+func (e *StdoutExporter) Export(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	encoder := json.NewEncoder(e.out)
+	for _, s := range spans {
+		s.mu.Lock()
+		line := map[string]interface{}{
+			"trace_id":    s.Context.TraceID.String(),
+			"span_id":     s.Context.SpanID.String(),
+			"name":        s.Name,
+			"start":       s.Start.UTC().Format(time.RFC3339Nano),
+			"duration_ms": float64(s.End.Sub(s.Start).Microseconds()) / 1000,
+			"attributes":  s.Attributes,
+		}
+		if s.ParentID != (SpanID{}) {
+			line["parent_id"] = s.ParentID.String()
+		}
+		if s.StatusError {
+			line["error"] = s.StatusMessage
+		}
+		s.mu.Unlock()
+
+		err := encoder.Encode(line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector with OTLP over HTTP, encoded as JSON
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+}
+
+// NewOTLPExporter() creates an exporter for the collector at endpoint, such as http://localhost:4318
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		if s.ParentID != (SpanID{}) {
+			span.ParentSpanID = s.ParentID.String()
+		}
+		//status codes: 0 unset, 2 error
+		if s.StatusError {
+			span.Status = otlpStatus{Code: 2, Message: s.StatusMessage}
+		}
+		s.mu.Unlock()
+		converted = append(converted, span)
+	}
+
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]string{"service.name": e.service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "mgomez.net/internal/tracing"},
+				"spans": converted,
+			}},
+		}},
+	}
+	js, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("otlp exporter: collector responded %s", res.Status)
+	}
+	return nil
+}
+
+// otlpAttributes() converts attributes sorted by key
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	converted := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		converted = append(converted, otlpAttribute{Key: key, Value: otlpValue{StringValue: attributes[key]}})
+	}
+	return converted
+}
@@ -0,0 +1,306 @@
+// Filename: MyReference/backend/internal/tracing/tracing.go
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind says what side of a call a span describes, the values match OTLP
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// TraceID and SpanID identify spans across services
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span that is passed on to other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Span is one timed operation within a trace. A nil *Span is valid and records nothing,
+// so callers don't need to check if tracing is on
+type Span struct {
+	tracer   *Tracer
+	Context  SpanContext
+	ParentID SpanID
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+	End      time.Time
+
+	mu            sync.Mutex
+	Attributes    map[string]string
+	StatusError   bool
+	StatusMessage string
+	ended         bool
+}
+
+// SetName() renames the span, for names only known once the work is done
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute() records a key and value on the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError() marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.StatusError = true
+	s.StatusMessage = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish() ends the span and hands it to the exporter, only the first call counts
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if s.Context.Sampled {
+		s.tracer.queue(s)
+	}
+}
+
+// An Exporter sends finished spans somewhere they can be looked at
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Tracer creates spans and exports them in batches from a background goroutine
+type Tracer struct {
+	service  string
+	exporter Exporter
+	ratio    float64
+	onError  func(error)
+	spans    chan *Span
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New() creates a tracer for the service. ratio is the share of new traces that are recorded,
+// traces started by a caller follow the caller's decision. onError is told about failed exports
+func New(service string, exporter Exporter, ratio float64, onError func(error)) *Tracer {
+	t := &Tracer{
+		service:  service,
+		exporter: exporter,
+		ratio:    ratio,
+		onError:  onError,
+		spans:    make(chan *Span, 2048),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Service() is the name spans are reported under
+func (t *Tracer) Service() string {
+	return t.service
+}
+
+// run() exports the queued spans every few seconds, or sooner once a batch has filled up
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := t.exporter.Export(ctx, batch)
+		cancel()
+		if err != nil && t.onError != nil {
+			t.onError(err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case span, ok := <-t.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= 256 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// queue() hands a finished span to the exporter, dropping it if the queue is full or the tracer shut down
+func (t *Tracer) queue(s *Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.spans <- s:
+	default:
+	}
+}
+
+// Shutdown() exports the remaining spans, spans finished afterwards are dropped
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.spans)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type spanContextKey struct{}
+
+// Start() begins a span. It is a child of the span in ctx, or of parent when ctx has none and
+// parent is valid, otherwise it starts a new trace
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	if current := FromContext(ctx); current != nil {
+		parent = current.Context
+	}
+
+	s := &Span{
+		tracer:     t,
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]string),
+	}
+	rand.Read(s.Context.SpanID[:])
+	if parent.TraceID != (TraceID{}) {
+		s.Context.TraceID = parent.TraceID
+		s.Context.Sampled = parent.Sampled
+		s.ParentID = parent.SpanID
+	} else {
+		rand.Read(s.Context.TraceID[:])
+		s.Context.Sampled = t.sample(s.Context.TraceID)
+	}
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// sample() decides whether a new trace is recorded, using the trace id so the decision is stable
+func (t *Tracer) sample(id TraceID) bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	var n uint64
+	for _, b := range id[8:] {
+		n = n<<8 | uint64(b)
+	}
+	return float64(n>>11)/float64(1<<53) < t.ratio
+}
+
+// StartChild() begins a span under the span in ctx. Without one nothing is recorded,
+// which lets packages such as data trace their work without holding a tracer
+func StartChild(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	current := FromContext(ctx)
+	if current == nil {
+		return ctx, nil
+	}
+	return current.tracer.Start(ctx, name, kind, current.Context)
+}
+
+// FromContext() returns the current span, nil when there is none
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// Extract() reads a W3C traceparent header
+func Extract(header http.Header) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(header.Get("traceparent")), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	//version 00 has exactly four fields, later versions may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	_, err1 := hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	_, err2 := hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	flags, err3 := hex.DecodeString(parts[3])
+	if err1 != nil || err2 != nil || err3 != nil || sc.TraceID == (TraceID{}) || sc.SpanID == (SpanID{}) {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// Inject() writes the traceparent header for the span in ctx
+func Inject(ctx context.Context, header http.Header) {
+	s := FromContext(ctx)
+	if s == nil {
+		return
+	}
+	flags := "00"
+	if s.Context.Sampled {
+		flags = "01"
+	}
+	header.Set("traceparent", "00-"+s.Context.TraceID.String()+"-"+s.Context.SpanID.String()+"-"+flags)
+}
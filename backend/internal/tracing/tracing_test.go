@@ -0,0 +1,171 @@
+// Filename: MyReference/backend/internal/tracing/tracing_test.go
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// exportedSpan is a line written by the stdout exporter
+type exportedSpan struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes"`
+	Error      string            `json:"error"`
+}
+
+// export() runs fn with a tracer writing to the stdout exporter and returns the spans it exported
+func export(t *testing.T, ratio float64, fn func(tracer *Tracer)) []exportedSpan {
+	t.Helper()
+	var out bytes.Buffer
+	tracer := New("test", NewStdoutExporter(&out), ratio, func(err error) { t.Error(err) })
+	fn(tracer)
+	err := tracer.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := []exportedSpan{}
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var span exportedSpan
+		err := decoder.Decode(&span)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+func TestExport(t *testing.T) {
+	header := make(http.Header)
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	outgoing := make(http.Header)
+
+	spans := export(t, 0, func(tracer *Tracer) {
+		parent, ok := Extract(header)
+		if !ok {
+			t.Fatal("traceparent was not extracted")
+		}
+		ctx, server := tracer.Start(context.Background(), "GET /v1/references", KindServer, parent)
+		server.SetAttribute("http.status_code", "200")
+
+		ctx, client := StartChild(ctx, "UserModel.Get", KindClient)
+		client.RecordError(errors.New("record not found"))
+		Inject(ctx, outgoing)
+		client.Finish()
+		client.Finish()
+		server.Finish()
+	})
+
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans exported; want 2", len(spans))
+	}
+	client, server := spans[0], spans[1]
+	for _, span := range spans {
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s: got trace id %q; want the caller's", span.Name, span.TraceID)
+		}
+	}
+	if server.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("got server parent %q; want the caller's span", server.ParentID)
+	}
+	if client.ParentID != server.SpanID {
+		t.Errorf("got client parent %q; want the server span %q", client.ParentID, server.SpanID)
+	}
+	if server.Attributes["http.status_code"] != "200" || server.Error != "" {
+		t.Errorf("got server attributes %v error %q", server.Attributes, server.Error)
+	}
+	if client.Error != "record not found" {
+		t.Errorf("got client error %q; want %q", client.Error, "record not found")
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + client.SpanID + "-01"
+	if got := outgoing.Get("traceparent"); got != want {
+		t.Errorf("got injected traceparent %q; want %q", got, want)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	tests := []struct {
+		name        string
+		ratio       float64
+		traceparent string
+		want        int
+	}{
+		{"new trace recorded", 1, "", 1},
+		{"new trace dropped", 0, "", 0},
+		{"caller sampled", 0, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", 1},
+		{"caller not sampled", 1, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			header.Set("traceparent", tt.traceparent)
+			spans := export(t, tt.ratio, func(tracer *Tracer) {
+				parent, _ := Extract(header)
+				_, span := tracer.Start(context.Background(), "request", KindServer, parent)
+				span.Finish()
+			})
+			if len(spans) != tt.want {
+				t.Errorf("got %d spans exported; want %d", len(spans), tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		valid       bool
+		sampled     bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"later version with more fields", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"missing", "", false, false},
+		{"version 00 with more fields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"short trace id", "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			header.Set("traceparent", tt.traceparent)
+			sc, ok := Extract(header)
+			if ok != tt.valid {
+				t.Fatalf("got valid %t; want %t", ok, tt.valid)
+			}
+			if sc.Sampled != tt.sampled {
+				t.Errorf("got sampled %t; want %t", sc.Sampled, tt.sampled)
+			}
+		})
+	}
+}
+
+func TestWithoutTracer(t *testing.T) {
+	//packages trace their work with StartChild whether or not the request is traced
+	ctx, span := StartChild(context.Background(), "UserModel.Get", KindClient)
+	if span != nil {
+		t.Fatal("got a span without a parent; want nil")
+	}
+	span.SetAttribute("db.system", "postgresql")
+	span.RecordError(errors.New("failed"))
+	span.Finish()
+
+	header := make(http.Header)
+	Inject(ctx, header)
+	if header.Get("traceparent") != "" {
+		t.Error("got a traceparent without a span; want none")
+	}
+}
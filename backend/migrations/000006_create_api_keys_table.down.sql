@@ -0,0 +1,2 @@
+-- Filename: MyReference/backend/migrations/000006_create_api_keys_table.down.sql
+drop table if exists api_keys;
\ No newline at end of file
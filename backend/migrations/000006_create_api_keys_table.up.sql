@@ -0,0 +1,14 @@
+-- Filename: MyReference/backend/migrations/000006_create_api_keys_table.up.sql
+create table if not exists api_keys(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    user_id bigint not null references users on delete cascade,
+    name text not null,
+    hash bytea unique not null,
+    permissions text[] not null,
+    allowed_ips text[] not null default '{}',
+    expiry timestamp(0) with time zone,
+    last_used_at timestamp(0) with time zone
+);
+
+create index if not exists api_keys_user_id_idx on api_keys (user_id);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Filename: MyReference/backend/migrations/000007_create_mfa_tables.down.sql
+drop table if exists recovery_codes;
+drop table if exists users_totp;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- Filename: MyReference/backend/migrations/000007_create_mfa_tables.up.sql
+create table if not exists users_totp(
+    user_id bigint primary key references users on delete cascade,
+    created_at timestamp(0) with time zone not null default now(),
+    secret text not null,
+    enabled bool not null default false,
+    last_used_step bigint not null default 0
+);
+
+create table if not exists recovery_codes(
+    hash bytea primary key,
+    user_id bigint not null references users on delete cascade,
+    used_at timestamp(0) with time zone
+);
\ No newline at end of file
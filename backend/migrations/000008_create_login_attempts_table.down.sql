@@ -0,0 +1,2 @@
+-- Filename: MyReference/backend/migrations/000008_create_login_attempts_table.down.sql
+drop table if exists login_attempts;
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- Filename: MyReference/backend/migrations/000008_create_login_attempts_table.up.sql
+create table if not exists login_attempts(
+    key text primary key,
+    failures integer not null default 0,
+    last_failure_at timestamp(0) with time zone not null default now(),
+    locked_until timestamp(0) with time zone
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- Filename: MyReference/backend/migrations/000009_create_email_changes_table.down.sql
+drop table if exists email_changes;
\ No newline at end of file
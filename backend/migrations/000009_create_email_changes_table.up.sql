@@ -0,0 +1,7 @@
+-- Filename: MyReference/backend/migrations/000009_create_email_changes_table.up.sql
+create table if not exists email_changes(
+    hash bytea primary key,
+    user_id bigint not null references users on delete cascade,
+    email citext not null,
+    expiry timestamp(0) with time zone not null
+);
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- Filename: MyReference/backend/migrations/000010_add_reference_info_owner.down.sql
+alter table reference_info
+drop column if exists user_id;
+
+do $$
+begin
+  if exists (select 1 from information_schema.columns where table_name = 'reference_info' and column_name = 'created_at') then
+    alter table reference_info rename column created_at to create_at;
+  end if;
+end $$;
\ No newline at end of file
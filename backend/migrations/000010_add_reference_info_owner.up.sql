@@ -0,0 +1,12 @@
+-- Filename: MyReference/backend/migrations/000010_add_reference_info_owner.up.sql
+do $$
+begin
+  if exists (select 1 from information_schema.columns where table_name = 'reference_info' and column_name = 'create_at') then
+    alter table reference_info rename column create_at to created_at;
+  end if;
+end $$;
+
+alter table reference_info
+add column if not exists user_id bigint references users on delete cascade;
+
+create index if not exists reference_info_user_id_idx on reference_info (user_id);
\ No newline at end of file
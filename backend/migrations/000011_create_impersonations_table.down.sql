@@ -0,0 +1,3 @@
+-- Filename: MyReference/backend/migrations/000011_create_impersonations_table.down.sql
+delete from permissions where code = 'users:admin';
+drop table if exists impersonations;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- Filename: MyReference/backend/migrations/000011_create_impersonations_table.up.sql
+create table if not exists impersonations(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    admin_id bigint references users on delete set null,
+    user_id bigint not null references users on delete cascade,
+    reason text not null,
+    token_hash bytea unique not null,
+    expiry timestamp(0) with time zone not null
+);
+
+insert into permissions (code)
+select 'users:admin'
+where not exists (select 1 from permissions where code = 'users:admin');
\ No newline at end of file
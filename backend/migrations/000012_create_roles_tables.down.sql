@@ -0,0 +1,5 @@
+-- Filename: MyReference/backend/migrations/000012_create_roles_tables.down.sql
+drop table if exists users_roles;
+drop table if exists roles_permissions;
+drop table if exists roles;
+delete from permissions where code in ('reference:read', 'reference:write');
\ No newline at end of file
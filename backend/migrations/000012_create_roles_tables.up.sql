@@ -0,0 +1,38 @@
+-- Filename: MyReference/backend/migrations/000012_create_roles_tables.up.sql
+create table if not exists roles(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    code text unique not null,
+    description text not null default ''
+);
+
+create table if not exists roles_permissions(
+    role_id bigint not null references roles (id) on delete cascade,
+    permissions_id bigint not null references permissions (id) on delete cascade,
+    primary key (role_id, permissions_id)
+);
+
+create table if not exists users_roles(
+    user_id bigint not null references users (id) on delete cascade,
+    role_id bigint not null references roles (id) on delete cascade,
+    primary key (user_id, role_id)
+);
+
+insert into permissions (code)
+select new_codes.code
+from (values ('reference:read'), ('reference:write')) as new_codes (code)
+where not exists (select 1 from permissions where permissions.code = new_codes.code);
+
+insert into roles (code, description)
+values ('user', 'Default role for newly registered users'),
+       ('editor', 'Can create and change references'),
+       ('admin', 'Can manage users, roles and permissions');
+
+insert into roles_permissions
+select roles.id, permissions.id
+from roles, permissions
+where (roles.code, permissions.code) in (
+    ('user', 'schools:read'), ('user', 'reference:read'),
+    ('editor', 'schools:read'), ('editor', 'reference:read'), ('editor', 'reference:write'),
+    ('admin', 'users:admin')
+);
\ No newline at end of file
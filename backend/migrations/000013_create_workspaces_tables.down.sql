@@ -0,0 +1,13 @@
+-- Filename: MyReference/backend/migrations/000013_create_workspaces_tables.down.sql
+alter table reference_info
+drop constraint if exists reference_info_user_id_fkey;
+
+alter table reference_info
+add constraint reference_info_user_id_fkey foreign key (user_id) references users on delete cascade;
+
+alter table reference_info
+drop column if exists workspace_id;
+
+drop table if exists workspace_members;
+
+drop table if exists workspaces;
\ No newline at end of file
@@ -0,0 +1,63 @@
+-- Filename: MyReference/backend/migrations/000013_create_workspaces_tables.up.sql
+create table if not exists workspaces(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    name text not null,
+    version integer not null default 1
+);
+
+create table if not exists workspace_members(
+    workspace_id bigint not null references workspaces on delete cascade,
+    user_id bigint not null references users on delete cascade,
+    role text not null check (role in ('owner', 'editor', 'viewer')),
+    created_at timestamp(0) with time zone not null default now(),
+    primary key (workspace_id, user_id)
+);
+
+create index if not exists workspace_members_user_id_idx on workspace_members (user_id);
+
+alter table reference_info
+add column if not exists workspace_id bigint references workspaces on delete cascade;
+
+-- every existing owner gets a personal workspace holding their references
+alter table workspaces add column legacy_user_id bigint;
+
+insert into workspaces (name, legacy_user_id)
+select distinct 'Personal', user_id
+from reference_info
+where user_id is not null;
+
+insert into workspace_members (workspace_id, user_id, role)
+select id, legacy_user_id, 'owner'
+from workspaces
+where legacy_user_id is not null;
+
+update reference_info
+set workspace_id = workspaces.id
+from workspaces
+where workspaces.legacy_user_id = reference_info.user_id;
+
+-- references without an owner go into a shared workspace that administrators can hand out
+with shared as (
+    insert into workspaces (name)
+    select 'Shared'
+    where exists (select 1 from reference_info where workspace_id is null)
+    returning id
+)
+update reference_info
+set workspace_id = (select id from shared)
+where workspace_id is null;
+
+alter table workspaces drop column legacy_user_id;
+
+alter table reference_info
+alter column workspace_id set not null;
+
+create index if not exists reference_info_workspace_id_idx on reference_info (workspace_id);
+
+-- references stay in their workspace when the account that created them is deleted
+alter table reference_info
+drop constraint if exists reference_info_user_id_fkey;
+
+alter table reference_info
+add constraint reference_info_user_id_fkey foreign key (user_id) references users on delete set null;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Filename: MyReference/backend/migrations/000014_create_invitations_table.down.sql
+drop table if exists invitations;
+
+delete from permissions
+where code = 'users:invite';
\ No newline at end of file
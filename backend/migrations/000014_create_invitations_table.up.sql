@@ -0,0 +1,25 @@
+-- Filename: MyReference/backend/migrations/000014_create_invitations_table.up.sql
+create table if not exists invitations(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    email citext not null,
+    invited_by bigint references users on delete set null,
+    workspace_id bigint references workspaces on delete cascade,
+    workspace_role text check (workspace_role in ('owner', 'editor', 'viewer')),
+    token_hash bytea unique not null,
+    expiry timestamp(0) with time zone not null,
+    accepted_at timestamp(0) with time zone,
+    revoked_at timestamp(0) with time zone
+);
+
+create index if not exists invitations_email_idx on invitations (email);
+
+insert into permissions (code)
+select 'users:invite'
+where not exists (select 1 from permissions where code = 'users:invite');
+
+insert into roles_permissions
+select roles.id, permissions.id
+from roles, permissions
+where roles.code = 'admin' and permissions.code = 'users:invite'
+on conflict do nothing;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Filename: MyReference/backend/migrations/000015_create_user_identities_table.down.sql
+drop table if exists oidc_states;
+
+drop table if exists user_identities;
\ No newline at end of file
@@ -0,0 +1,19 @@
+-- Filename: MyReference/backend/migrations/000015_create_user_identities_table.up.sql
+create table if not exists user_identities(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    user_id bigint not null references users on delete cascade,
+    issuer text not null,
+    subject text not null,
+    email citext not null default '',
+    unique (issuer, subject)
+);
+
+create index if not exists user_identities_user_id_idx on user_identities (user_id);
+
+create table if not exists oidc_states(
+    state_hash bytea primary key,
+    nonce text not null,
+    code_verifier text not null,
+    expiry timestamp(0) with time zone not null
+);
\ No newline at end of file
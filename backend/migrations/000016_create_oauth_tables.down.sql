@@ -0,0 +1,6 @@
+-- Filename: MyReference/backend/migrations/000016_create_oauth_tables.down.sql
+drop table if exists oauth_tokens;
+
+drop table if exists oauth_codes;
+
+drop table if exists oauth_clients;
\ No newline at end of file
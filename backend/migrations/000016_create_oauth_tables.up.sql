@@ -0,0 +1,32 @@
+-- Filename: MyReference/backend/migrations/000016_create_oauth_tables.up.sql
+create table if not exists oauth_clients(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    client_id text unique not null,
+    secret_hash bytea,
+    name text not null,
+    redirect_uris text[] not null,
+    scopes text[] not null,
+    owner_id bigint not null references users on delete cascade
+);
+
+create table if not exists oauth_codes(
+    code_hash bytea primary key,
+    client_id bigint not null references oauth_clients on delete cascade,
+    user_id bigint not null references users on delete cascade,
+    redirect_uri text not null,
+    scopes text[] not null,
+    code_challenge text not null,
+    expiry timestamp(0) with time zone not null
+);
+
+create table if not exists oauth_tokens(
+    token_hash bytea primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    client_id bigint not null references oauth_clients on delete cascade,
+    user_id bigint not null references users on delete cascade,
+    scopes text[] not null,
+    expiry timestamp(0) with time zone not null
+);
+
+create index if not exists oauth_tokens_user_id_idx on oauth_tokens (user_id);
\ No newline at end of file
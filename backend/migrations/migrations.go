@@ -0,0 +1,9 @@
+// Filename: MyReference/backend/migrations/migrations.go
+package migrations
+
+import "embed"
+
+// FS holds the SQL migrations, compiled into the API binary so it can migrate its own database
+//
+//go:embed *.sql
+var FS embed.FS